@@ -0,0 +1,104 @@
+package chatbots
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/doylecnn/contribution_bot/storage"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+var roleRank = map[string]int{
+	storage.RoleReviewer: 1,
+	storage.RoleEditor:   2,
+	storage.RoleOwner:    3,
+}
+
+// hasRole report whether user is an admin with role or a more privileged one.
+// the BOT_ADMIN user is always an owner
+func (c ChatBot) hasRole(userID int, role string) bool {
+	userRole := c.roleOf(userID)
+	return len(userRole) != 0 && roleRank[userRole] >= roleRank[role]
+}
+
+// roleOf admin role of the user, empty for contributors
+func (c ChatBot) roleOf(userID int) string {
+	if userID == c.adminID {
+		return storage.RoleOwner
+	}
+	admin, err := c.storage.GetAdmin(context.Background(), userID)
+	if err != nil {
+		if err != storage.ErrAdminNotFound {
+			c.logger.Error().Err(err).Int("userID", userID).Send()
+		}
+		return ""
+	}
+	return admin.Role
+}
+
+func cmdAdmins(c ChatBot, message *tgbotapi.Message) (err error) {
+	admins, err := c.storage.GetAdmins(context.Background())
+	if err != nil {
+		return
+	}
+	lines := []string{fmt.Sprintf("%s: %d (BOT_ADMIN)", storage.RoleOwner, c.adminID)}
+	for _, admin := range admins {
+		lines = append(lines, fmt.Sprintf("%s: %s %d", admin.Role, admin.Name, admin.UserID))
+	}
+	_, err = c.botClient.Send(tgbotapi.NewMessage(message.Chat.ID, strings.Join(lines, "\n")))
+	return
+}
+
+// cmdAddAdmin /addadmin <user_id> <role>, or reply to a message of the user with /addadmin <role>
+func cmdAddAdmin(c ChatBot, message *tgbotapi.Message) (err error) {
+	args := newCommandArgs(message)
+	userID, name, _ := c.commandTarget(message, args)
+	role := args.String("role")
+	if len(role) != 0 && roleRank[role] == 0 {
+		args.Fail("unknown_role", role)
+	}
+	if err = args.Err(); err != nil {
+		return
+	}
+	admin := storage.Admin{UserID: userID, Name: name, Role: role}
+	if err = c.storage.SaveAdmin(context.Background(), admin); err != nil {
+		return
+	}
+	c.syncAdminMenu(admin.UserID, admin.Role)
+	_, err = c.botClient.Send(tgbotapi.NewMessage(message.Chat.ID,
+		translate(message.From.LanguageCode, "admin_now", admin.UserID, admin.Role)))
+	return
+}
+
+// cmdDelAdmin /deladmin <user_id>, or reply to a message of the user with /deladmin
+func cmdDelAdmin(c ChatBot, message *tgbotapi.Message) (err error) {
+	args := newCommandArgs(message)
+	userID, _, _ := c.commandTarget(message, args)
+	if err = args.Err(); err != nil {
+		return
+	}
+	if err = c.storage.DeleteAdmin(context.Background(), userID); err != nil {
+		return
+	}
+	c.syncAdminMenu(userID, "")
+	_, err = c.botClient.Send(tgbotapi.NewMessage(message.Chat.ID,
+		translate(message.From.LanguageCode, "admin_removed", userID)))
+	return
+}
+
+// commandTarget the user a command is about: the contributor of the replied
+// forwarded message, the author of the replied message, or the user id read
+// from args. ticket is the forward id when the contributor was found by a reply
+func (c ChatBot) commandTarget(message *tgbotapi.Message, args *commandArgs) (userID int, name string, ticket int) {
+	if reply := message.ReplyToMessage; reply != nil && reply.From != nil {
+		if !reply.From.IsBot {
+			return reply.From.ID, displayName(reply.From), 0
+		}
+		if originmsg, err := c.storage.GetMessage(context.Background(), reply.MessageID); err == nil {
+			return originmsg.UserID, originmsg.Username, originmsg.ForwardID
+		}
+	}
+	userID = args.Int("user_id")
+	return userID, fmt.Sprintf("@%d", userID), 0
+}
@@ -0,0 +1,82 @@
+package chatbots
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// usageError bad command arguments, the router sends it back to the user with the usage
+type usageError struct {
+	catalogError
+}
+
+// commandArgs reads the arguments of a command one by one. the first problem is
+// remembered and returned as a usageError by Err
+type commandArgs struct {
+	fields []string
+	err    error
+}
+
+func newCommandArgs(message *tgbotapi.Message) *commandArgs {
+	return &commandArgs{fields: strings.Fields(message.CommandArguments())}
+}
+
+// Len number of arguments left
+func (a *commandArgs) Len() int {
+	return len(a.fields)
+}
+
+// String next argument
+func (a *commandArgs) String(name string) string {
+	if len(a.fields) == 0 {
+		a.Fail("missing_arg", name)
+		return ""
+	}
+	s := a.fields[0]
+	a.fields = a.fields[1:]
+	return s
+}
+
+// Int next argument as a number, a leading # is allowed for ticket numbers
+func (a *commandArgs) Int(name string) int {
+	s := a.String(name)
+	if a.err != nil {
+		return 0
+	}
+	n, err := strconv.Atoi(strings.TrimPrefix(s, "#"))
+	if err != nil {
+		a.Fail("not_a_number", name, s)
+	}
+	return n
+}
+
+// Rest all arguments left, joined by spaces
+func (a *commandArgs) Rest() string {
+	s := strings.Join(a.fields, " ")
+	a.fields = nil
+	return s
+}
+
+// Fail reject the arguments with the catalog message key unless they were rejected already
+func (a *commandArgs) Fail(key string, v ...interface{}) {
+	if a.err == nil {
+		a.err = usageError{catalogError{key: key, args: v}}
+	}
+}
+
+// Err the first problem with the arguments, or extra arguments nobody read
+func (a *commandArgs) Err() error {
+	if a.err == nil && len(a.fields) != 0 {
+		a.Fail("unexpected_args", strings.Join(a.fields, " "))
+	}
+	return a.err
+}
+
+// asUsageError the usageError in err, to be shown to the user
+func asUsageError(err error) (usage usageError, ok bool) {
+	ok = errors.As(err, &usage)
+	return
+}
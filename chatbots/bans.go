@@ -0,0 +1,152 @@
+package chatbots
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/doylecnn/contribution_bot/storage"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// anonymous report whether the review group must not see who contributors are,
+// assumed when the settings can not be read
+func (c ChatBot) anonymous() bool {
+	settings, err := c.settings.Get(context.Background())
+	if err != nil {
+		c.logger.Error().Err(err).Send()
+		return true
+	}
+	return settings.Anonymous
+}
+
+// isBanned report whether the user has an active ban, expired bans are removed
+func (c ChatBot) isBanned(userID int) bool {
+	ban, err := c.storage.GetBan(context.Background(), userID)
+	if err != nil {
+		if err != storage.ErrBanNotFound {
+			c.logger.Error().Err(err).Int("userID", userID).Send()
+		}
+		return false
+	}
+	if ban.Active(time.Now()) {
+		return true
+	}
+	if err = c.storage.DeleteBan(context.Background(), userID); err != nil {
+		c.logger.Error().Err(err).Int("userID", userID).Send()
+	}
+	return false
+}
+
+// parseBanDuration like time.ParseDuration, also accepting whole days such as "7d"
+func parseBanDuration(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err == nil && days > 0 {
+			return time.Duration(days) * 24 * time.Hour, nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err == nil && d <= 0 {
+		err = fmt.Errorf("ban duration must be positive: %s", s)
+	}
+	return d, err
+}
+
+// cmdBan /ban [user_id] [duration] [reason], replying to a forwarded
+// submission bans its contributor
+func cmdBan(c ChatBot, message *tgbotapi.Message) (err error) {
+	args := newCommandArgs(message)
+	userID, name, ticket := c.commandTarget(message, args)
+	reason := args.Rest()
+	if err = args.Err(); err != nil {
+		return
+	}
+	if c.hasRole(userID, storage.RoleReviewer) {
+		_, err = c.botClient.Send(tgbotapi.NewMessage(message.Chat.ID, translate(message.From.LanguageCode, "cannot_ban_admin")))
+		return
+	}
+	now := time.Now()
+	ban := storage.Ban{
+		UserID:    userID,
+		Name:      name,
+		BannedBy:  message.From.ID,
+		CreatedAt: now,
+		Ticket:    ticket,
+	}
+	if fields := strings.Fields(reason); len(fields) > 0 {
+		if d, e := parseBanDuration(fields[0]); e == nil {
+			ban.Until = now.Add(d)
+			reason = strings.Join(fields[1:], " ")
+		}
+	}
+	ban.Reason = reason
+	if err = c.storage.SaveBan(context.Background(), ban); err != nil {
+		return
+	}
+	_, err = c.botClient.Send(tgbotapi.NewMessage(message.Chat.ID,
+		translate(message.From.LanguageCode, "banned", banString(message.From.LanguageCode, ban, c.anonymous()))))
+	return
+}
+
+// cmdUnban /unban <user_id>, or reply to a forwarded submission with /unban
+func cmdUnban(c ChatBot, message *tgbotapi.Message) (err error) {
+	args := newCommandArgs(message)
+	userID, name, ticket := c.commandTarget(message, args)
+	if err = args.Err(); err != nil {
+		return
+	}
+	if err = c.storage.DeleteBan(context.Background(), userID); err != nil {
+		return
+	}
+	subject := banSubject(message.From.LanguageCode, storage.Ban{UserID: userID, Name: name, Ticket: ticket}, c.anonymous())
+	_, err = c.botClient.Send(tgbotapi.NewMessage(message.Chat.ID, translate(message.From.LanguageCode, "unbanned", subject)))
+	return
+}
+
+func cmdBans(c ChatBot, message *tgbotapi.Message) (err error) {
+	bans, err := c.storage.GetBans(context.Background())
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	anonymous := c.anonymous()
+	var lines []string
+	for _, ban := range bans {
+		if ban.Active(now) {
+			lines = append(lines, banString(message.From.LanguageCode, ban, anonymous))
+		}
+	}
+	text := translate(message.From.LanguageCode, "no_bans")
+	if len(lines) > 0 {
+		text = strings.Join(lines, "\n")
+	}
+	_, err = c.botClient.Send(tgbotapi.NewMessage(message.Chat.ID, text))
+	return
+}
+
+// banSubject who is banned. in anonymous mode contributors banned on a
+// submission are referred to by its ticket only
+func banSubject(languageCode string, ban storage.Ban, anonymous bool) string {
+	switch {
+	case !anonymous:
+		return fmt.Sprintf("%s %d", ban.Name, ban.UserID)
+	case ban.Ticket != 0:
+		return translate(languageCode, "ticket_ref", ban.Ticket)
+	}
+	return strconv.Itoa(ban.UserID)
+}
+
+func banString(languageCode string, ban storage.Ban, anonymous bool) string {
+	subject := banSubject(languageCode, ban, anonymous)
+	s := translate(languageCode, "ban_forever", subject)
+	if !ban.Until.IsZero() {
+		s = translate(languageCode, "ban_until", subject, ban.Until.UTC().Format("2006-01-02 15:04 UTC"))
+	}
+	if len(ban.Reason) != 0 {
+		s += ": " + ban.Reason
+	}
+	return s
+}
@@ -1,49 +1,74 @@
 package chatbots
 
 import (
-	"strings"
+	"context"
+	"fmt"
 
+	"github.com/doylecnn/contribution_bot/storage"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
 )
 
+// settingsCallbackPrefix callback data of settings buttons, followed by the settings field
+// and for texts the language they are edited for
+const settingsCallbackPrefix = "/change_"
+
 func (c ChatBot) handleCallbackQuery(query *tgbotapi.CallbackQuery) {
-	if query.From.ID != c.adminID {
-		return
+	if err := c.callbacks.run(c, query); err != nil {
+		c.logger.Error().Err(err).Send()
 	}
+}
 
-	if !strings.HasPrefix(query.Data, "/change_") {
+// cbChangeSetting ask the editor for the new value of the field in args,
+// texts are followed by the language they are edited for
+func cbChangeSetting(c ChatBot, query *tgbotapi.CallbackQuery, args []string) (err error) {
+	if len(args) != 1 && len(args) != 2 {
+		return fmt.Errorf("bad settings callback %q", query.Data)
+	}
+	languageCode := query.From.LanguageCode
+	field, textsLanguage := args[0], ""
+	if len(args) == 2 {
+		textsLanguage = args[1]
+	}
+	if _, ok := settingsFields[field]; !ok || (len(textsLanguage) != 0 && !validLanguage(textsLanguage)) {
+		c.botClient.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, translate(languageCode, "unknown_setting")))
 		return
 	}
-
-	var replyText string
-	switch query.Data {
-	case "/change_welcome_words":
-		replyText = "change welcome words:"
-		break
-	case "/change_bot_info":
-		replyText = "change bot info:"
-		break
-	case "/change_thanks":
-		replyText = "change thanks words:"
-		break
-	case "/change_forward_to_chat_id":
-		replyText = "change forward to chat id:"
-		break
-	case "/change_done":
-		c.botClient.DeleteMessage(tgbotapi.NewDeleteMessage(query.Message.Chat.ID, query.Message.MessageID))
-		c.botClient.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, "done"))
+	c.botClient.DeleteMessage(tgbotapi.NewDeleteMessage(query.Message.Chat.ID, query.Message.MessageID))
+	if err = c.askSettingsField(query.From, field, textsLanguage); err != nil {
+		c.botClient.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, translate(languageCode, "update_failed")))
 		return
 	}
+	_, err = c.botClient.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, translate(languageCode, "update_request_received")))
+	return
+}
+
+// cbSettingsDone close the settings menu
+func cbSettingsDone(c ChatBot, query *tgbotapi.CallbackQuery, args []string) (err error) {
 	c.botClient.DeleteMessage(tgbotapi.NewDeleteMessage(query.Message.Chat.ID, query.Message.MessageID))
-	_, err := c.botClient.Send(tgbotapi.MessageConfig{
-		BaseChat: tgbotapi.BaseChat{
-			ChatID:      int64(query.From.ID),
-			ReplyMarkup: tgbotapi.ForceReply{ForceReply: true, Selective: true},
-		},
-		Text: replyText,
+	_, err = c.botClient.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, translate(query.From.LanguageCode, "done")))
+	return
+}
+
+// cbToggleAnonymous switch anonymous mode on or off, args keep the language texts are edited for
+func cbToggleAnonymous(c ChatBot, query *tgbotapi.CallbackQuery, args []string) (err error) {
+	languageCode := query.From.LanguageCode
+	settings, err := c.settings.Update(context.Background(), func(settings *storage.Settings) error {
+		settings.Anonymous = !settings.Anonymous
+		return nil
 	})
 	if err != nil {
-		c.logger.Error().Err(err).Send()
+		c.botClient.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, translate(languageCode, "update_failed")))
+		return
+	}
+	var textsLanguage string
+	if len(args) == 1 && validLanguage(args[0]) {
+		textsLanguage = args[0]
 	}
-	c.botClient.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, "update request received"))
+	markup := settingsMarkup(languageCode, textsLanguage)
+	edit := tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID,
+		settingsText(languageCode, textsLanguage, translate(languageCode, "update_success", settingsString(languageCode, settings))))
+	edit.ReplyMarkup = &markup
+	c.botClient.Send(edit)
+	_, err = c.botClient.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, translate(languageCode, "anonymous_state", settings.Anonymous)))
+	return
 }
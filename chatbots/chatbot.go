@@ -5,9 +5,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
-	"strconv"
 	"strings"
+	"time"
 
 	"github.com/doylecnn/contribution_bot/stackdriverhook"
 	"github.com/doylecnn/contribution_bot/storage"
@@ -20,22 +19,43 @@ import (
 
 // ChatBot is chat bot
 type ChatBot struct {
-	logwriter       *stackdriverhook.StackdriverLoggingWriter
-	logger          zerolog.Logger
-	botClient       *tgbotapi.BotAPI
-	router          router
-	projectID       string
-	appID           string
-	token           string
-	adminID         int
-	forwardToChatID int64
-	domain          string
-	port            string
-	storage         storage.Storage
+	logwriter *stackdriverhook.StackdriverLoggingWriter
+	logger    zerolog.Logger
+	botClient TelegramClient
+	router    router
+	callbacks callbackRouter
+	projectID string
+	appID     string
+	adminID   int
+	domain    string
+	port      string
+	polling   bool
+	workers   int
+	storage   storage.Storage
+	settings  *settingsCache
+}
+
+// Config chat bot config
+type Config struct {
+	Token     string
+	Domain    string
+	AppID     string
+	ProjectID string
+	Port      string
+	AdminID   int
+	// Polling receive updates with getUpdates instead of a webhook
+	Polling bool
+	// Workers number of goroutines handling updates, at least 1
+	Workers int
+	// Client overrides the telegram client, NewChatBot connects to telegram with Token when nil
+	Client TelegramClient
+	// Pacing overrides how requests to telegram are spaced and retried, telegram's limits when nil
+	Pacing *SendPacing
 }
 
 // NewChatBot return new chat bot
-func NewChatBot(token, domain, appID, projectID, port string, adminID int) ChatBot {
+func NewChatBot(config Config, s storage.Storage) ChatBot {
+	token, projectID := config.Token, config.ProjectID
 	var logger zerolog.Logger
 	sw, err := stackdriverhook.NewStackdriverLoggingWriter(projectID, "bot", map[string]string{"from": "bot"})
 	if err != nil {
@@ -44,40 +64,65 @@ func NewChatBot(token, domain, appID, projectID, port string, adminID int) ChatB
 	} else {
 		logger = zerolog.New(sw).Level(zerolog.DebugLevel)
 	}
-	bot, err := tgbotapi.NewBotAPI(token)
-	if err != nil {
-		logger.Fatal().Err(err).Send()
+	bot := config.Client
+	var username string
+	if bot == nil {
+		api, err := tgbotapi.NewBotAPI(token)
+		if err != nil {
+			logger.Fatal().Err(err).Send()
+		}
+		api.Debug = false
+		logger.Info().Str("bot username", api.Self.UserName).
+			Int("bot id", api.Self.ID).Msg("authorized success")
+		bot = api
+		username = api.Self.UserName
+	} else if username, err = botUsername(bot); err != nil {
+		logger.Error().Err(err).Msg("get bot username failed, commands to other bots are not ignored")
 	}
-	bot.Debug = false
-	logger.Info().Str("bot username", bot.Self.UserName).
-		Int("bot id", bot.Self.ID).Msg("authorized success")
-
-	s := storage.NewStorage(projectID)
 
-	c := ChatBot{botClient: bot,
-		router:    newRouter(),
+	pacing := telegramPacing
+	if config.Pacing != nil {
+		pacing = *config.Pacing
+	}
+	c := ChatBot{botClient: newSender(bot, s, logger, pacing),
+		router:    newRouter(username, recoverCommand, logCommand, limitCommands),
+		callbacks: newCallbackRouter(),
 		projectID: projectID,
-		appID:     appID,
-		token:     token,
+		appID:     config.AppID,
 		logger:    logger,
 		logwriter: sw,
-		domain:    domain,
-		port:      port,
-		adminID:   adminID,
+		domain:    config.Domain,
+		port:      config.Port,
+		adminID:   config.AdminID,
+		polling:   config.Polling,
+		workers:   config.Workers,
 		storage:   s,
+		settings:  newSettingsCache(s, settingsTTL),
 	}
-	settings, err := s.GetSettings(context.Background())
-	if err != nil {
+	if _, err = c.settings.Get(context.Background()); err != nil {
 		logger.Warn().Err(err).Msg("need set settings")
-	} else {
-		c.forwardToChatID = settings.ForwardMessageToChatID
 	}
 
 	c.initCommands()
+	c.initCallbacks()
+	c.syncCommands()
+	c.settings.OnChange(func(old, new storage.Settings) {
+		if old.ForwardMessageToChatID != new.ForwardMessageToChatID {
+			c.logger.Info().Int64("from", old.ForwardMessageToChatID).Int64("to", new.ForwardMessageToChatID).
+				Msg("review group changed, move its commands")
+			c.moveReviewGroupMenu(old.ForwardMessageToChatID, new.ForwardMessageToChatID)
+		}
+	})
 
 	return c
 }
 
+// updatesBuffer capacity of the channels between the inbox and the workers
+const updatesBuffer = 100
+
+// allowedUpdates update types the bot subscribes to
+var allowedUpdates = []string{"message", "callback_query"}
+
 // Run run the bot
 func (c ChatBot) Run() {
 	var zerologger zerolog.Logger
@@ -96,36 +141,77 @@ func (c ChatBot) Run() {
 		UTC:    true,
 	}), gin.Recovery())
 
-	updates := make(chan tgbotapi.Update, c.botClient.Buffer)
-	r.POST("/"+c.token, func(c *gin.Context) {
-		bytes, _ := ioutil.ReadAll(c.Request.Body)
-
-		var update tgbotapi.Update
-		json.Unmarshal(bytes, &update)
-
-		updates <- update
-	})
+	shards := newUpdateShards(c.workers, updatesBuffer)
+	notify := make(chan struct{}, 1)
+	var webhook storage.Webhook
+	if !c.polling {
+		if webhook, err = c.initWebhook(); err != nil {
+			c.logger.Fatal().Err(err).Msg("init webhook failed")
+		}
+		r.POST("/"+webhook.Path, requireSecretToken(webhook.SecretToken), c.webhookHandler(notify))
+	}
 
 	r.GET("/cron/clearmessages", c.cleanmessages)
+	r.GET("/cron/publish", c.publishNext)
 
-	for i := 0; i < 2; i++ {
-		go c.messageHandlerWorker(updates)
+	for _, items := range shards {
+		go c.messageHandlerWorker(items)
 	}
+	go c.dispatchInbox(shards, notify)
 
-	if err = c.SetWebhook(); err != nil {
+	if c.polling {
+		go c.pollUpdates(notify)
+	} else if err = c.SetWebhook(webhook); err != nil {
 		c.logger.Error().Err(err).Msg("SetWebhook failed")
 	}
 	r.Run(fmt.Sprintf(":%s", c.port))
 }
 
+// pollUpdates long poll getUpdates and store updates in the inbox,
+// the webhook is removed first because telegram refuses getUpdates while one is set.
+// the offset only moves past updates that were stored
+func (c ChatBot) pollUpdates(notify chan<- struct{}) {
+	if _, err := c.deleteWebhook(); err != nil {
+		c.logger.Error().Err(err).Msg("deleteWebhook failed")
+	}
+	c.logger.Info().Msg("start polling updates")
+	offset := 0
+	for {
+		received, err := c.getUpdates(offset, 60, allowedUpdates)
+		if err != nil {
+			c.logger.Error().Err(err).Msg("getUpdates failed, retrying in 3 seconds")
+			time.Sleep(3 * time.Second)
+			continue
+		}
+		for _, data := range received {
+			var update tgbotapi.Update
+			if err = json.Unmarshal(data, &update); err != nil {
+				c.logger.Error().Err(err).Msg("drop bad update")
+				continue
+			}
+			if update.UpdateID < offset {
+				continue
+			}
+			if err = c.receiveUpdate(data, notify); err != nil {
+				c.logger.Error().Err(err).Int("updateID", update.UpdateID).Msg("save update failed, retrying in 3 seconds")
+				time.Sleep(3 * time.Second)
+				break
+			}
+			offset = update.UpdateID + 1
+		}
+	}
+}
+
 // Close close bot
 func (c ChatBot) Close() {
 	c.storage.Close()
-	c.logwriter.Close()
+	if c.logwriter != nil {
+		c.logwriter.Close()
+	}
 }
 
-// SetWebhook set webhook
-func (c ChatBot) SetWebhook() (err error) {
+// SetWebhook set webhook, unless telegram already delivers to webhook.Path
+func (c ChatBot) SetWebhook(webhook storage.Webhook) (err error) {
 	info, err := c.botClient.GetWebhookInfo()
 	if err != nil {
 		return
@@ -133,12 +219,14 @@ func (c ChatBot) SetWebhook() (err error) {
 	if info.LastErrorDate != 0 {
 		c.logger.Info().Str("last error message", info.LastErrorMessage).Msg("Telegram callback failed")
 	}
-	if !info.IsSet() {
+	webhookURL := fmt.Sprintf("https://%s/%s", c.domain, webhook.Path)
+	if info.URL != webhookURL {
 		var webhookConfig WebhookConfig
-		var wc = tgbotapi.NewWebhook(fmt.Sprintf("https://%s/%s", c.domain, c.token))
+		var wc = tgbotapi.NewWebhook(webhookURL)
 		webhookConfig = WebhookConfig{WebhookConfig: wc}
 		webhookConfig.MaxConnections = 20
-		webhookConfig.AllowedUpdates = []string{"message", "callback_query"}
+		webhookConfig.AllowedUpdates = allowedUpdates
+		webhookConfig.SecretToken = webhook.SecretToken
 		var apiResp tgbotapi.APIResponse
 		apiResp, err = c.setWebhook(webhookConfig)
 		if err != nil {
@@ -160,172 +248,273 @@ func (c ChatBot) SetWebhook() (err error) {
 	return
 }
 
-func (c ChatBot) messageHandlerWorker(updates chan tgbotapi.Update) {
-	for update := range updates {
-		callbackQuery := update.CallbackQuery
-		message := update.Message
-		if (message != nil &&
-			(message.From.IsBot ||
-				message.LeftChatMember != nil ||
-				message.NewChatMembers != nil)) ||
-			(callbackQuery != nil &&
-				callbackQuery.From.IsBot) {
+// processedUpdateTTL how long handled update ids are remembered,
+// telegram gives up redelivering an update within a day
+const processedUpdateTTL = 24 * time.Hour
+
+// messageHandlerWorker handle updates and acknowledge them in the inbox.
+// an update is handled only while its claim still holds the lease, one that
+// waited out its lease and was claimed again is left to the new claim.
+// updates telegram delivered again after they were handled are dropped
+func (c ChatBot) messageHandlerWorker(items chan inboxItem) {
+	for item := range items {
+		update := item.update
+		renewed, err := c.storage.RenewInboxUpdate(context.Background(), update.UpdateID, item.claimedUntil, time.Now().Add(inboxLease))
+		if err != nil {
+			c.logger.Error().Err(err).Int("updateID", update.UpdateID).Msg("renew lease failed")
+		} else if !renewed {
+			c.logger.Info().Int("updateID", update.UpdateID).Msg("lease lost, update left to its new claim")
 			continue
 		}
-		if callbackQuery != nil {
-			c.handleCallbackQuery(callbackQuery)
-		} else if message != nil {
-			if message.IsCommand() {
-				err := c.router.run(c, message)
+		processed, err := c.storage.IsUpdateProcessed(context.Background(), update.UpdateID)
+		if err != nil {
+			c.logger.Error().Err(err).Int("updateID", update.UpdateID).Send()
+		}
+		if processed {
+			c.logger.Info().Int("updateID", update.UpdateID).Msg("drop duplicate update")
+		} else {
+			c.handleUpdate(update)
+			err = c.storage.MarkUpdateProcessed(context.Background(), update.UpdateID, time.Now().Add(processedUpdateTTL))
+			if err != nil {
+				c.logger.Error().Err(err).Int("updateID", update.UpdateID).Send()
+			}
+		}
+		if err = c.storage.AckInboxUpdate(context.Background(), update.UpdateID); err != nil {
+			c.logger.Error().Err(err).Int("updateID", update.UpdateID).Msg("ack update failed")
+		}
+	}
+}
+
+func (c ChatBot) handleUpdate(update tgbotapi.Update) {
+	callbackQuery := update.CallbackQuery
+	message := update.Message
+	if (message != nil &&
+		(message.From.IsBot ||
+			message.LeftChatMember != nil ||
+			message.NewChatMembers != nil)) ||
+		(callbackQuery != nil &&
+			callbackQuery.From.IsBot) {
+		return
+	}
+	if message != nil && message.MigrateToChatID != 0 {
+		if err := c.migrateChat(message.Chat.ID, message.MigrateToChatID); err != nil {
+			c.logger.Error().Err(err).Send()
+		}
+		return
+	}
+	if callbackQuery != nil {
+		c.handleCallbackQuery(callbackQuery)
+	} else if message != nil {
+		if message.IsCommand() {
+			err := c.router.run(c, message)
+			if err != nil {
+				c.logger.Error().Err(err).Send()
+			}
+		} else {
+			if message.Chat.IsPrivate() {
+				if c.continueConversation(message) {
+					return
+				}
+				if c.isBanned(message.From.ID) {
+					return
+				}
+				settings, err := c.settings.Get(context.Background())
 				if err != nil {
 					c.logger.Error().Err(err).Send()
+					return
 				}
-			} else {
-				if message.From.ID == c.adminID && message.ReplyToMessage != nil && message.ReplyToMessage.From.IsBot {
-					if strings.HasPrefix(message.ReplyToMessage.Text, "change") {
-						settings, _ := c.storage.GetSettings(context.Background())
-						switch message.ReplyToMessage.Text {
-						case "change welcome words:":
-							settings.WelcomeWords = message.Text
-							break
-						case "change bot info:":
-							settings.BotInfo = message.Text
-							break
-						case "change thanks words:":
-							settings.Thanks = message.Text
-							break
-						case "change forward to chat id:":
-							chatID, err := strconv.ParseInt(message.Text, 10, 64)
-							if err == nil {
-								settings.ForwardMessageToChatID = chatID
-								c.forwardToChatID = settings.ForwardMessageToChatID
-							} else {
-								c.logger.Error().Err(err).Send()
-							}
-							break
-						}
-						err := c.storage.SaveSettings(context.Background(), settings)
-						var replyText string
-						if err != nil {
-							c.logger.Error().Err(err).Send()
-							replyText = "update failed\n error:" + err.Error() + "\n" + settings.String()
-						} else {
-							replyText = "update success\n" + settings.String()
-						}
-						c.botClient.Send(tgbotapi.MessageConfig{
-							BaseChat: tgbotapi.BaseChat{
-								ChatID:      message.Chat.ID,
-								ReplyMarkup: settingsMarkup(),
-							},
-							Text: replyText,
-						})
-						continue
-					}
+				if !c.allowSubmission(message, settings) {
+					return
 				}
-				if message.Chat.IsPrivate() {
-					if c.forwardToChatID != 0 {
-						if err := c.forward(message); err != nil {
-							c.logger.Error().Err(err).Send()
-						}
-					}
-				} else if message.ReplyToMessage != nil &&
-					(message.Chat.IsGroup() ||
-						message.Chat.IsSuperGroup()) {
-					if err := c.reply(message); err != nil {
+				if settings.ForwardMessageToChatID != 0 {
+					if err := c.forward(message); err != nil {
 						c.logger.Error().Err(err).Send()
 					}
 				}
+			} else if message.ReplyToMessage != nil &&
+				(message.Chat.IsGroup() ||
+					message.Chat.IsSuperGroup()) {
+				if err := c.reply(message); err != nil {
+					c.logger.Error().Err(err).Send()
+				}
 			}
 		}
 	}
 }
 
+// forward save the submission, send it to the review group and record its forward id.
+// the unread row is written first so nothing reaches the review group unstored, once
+// forwarded the message is saved with its forward id and status in one transaction,
+// and the ticket is posted only after that committed
 func (c ChatBot) forward(message *tgbotapi.Message) error {
-	var username string = message.From.UserName
-	if len(username) == 0 {
-		username = message.From.FirstName
-		if len(username) == 0 {
-			username = fmt.Sprintf("@%d", message.From.ID)
-		}
+	settings, err := c.settings.Get(context.Background())
+	if err != nil {
+		c.logger.Error().Err(err).Send()
+		return err
 	}
 	msg := storage.Message{
-		Username:  username,
+		Username:  displayName(message.From),
 		UserID:    message.From.ID,
 		ChatID:    message.Chat.ID,
 		MessageID: message.MessageID,
 		Time:      message.Time(),
-		Status:    "unread",
-		ForwardID: 0,
+		Status:    storage.StatusUnread,
+		// notices about the submission are sent in the contributor's language
+		LanguageCode: message.From.LanguageCode,
 	}
-	docRef, err := c.storage.CreateNewMessage(context.Background(), msg)
-	if err != nil {
+	// nothing is in the review group yet, so sending again is safe
+	if msg.ID, err = c.storage.CreateNewMessage(context.Background(), msg); err != nil {
 		c.logger.Error().Err(err).Send()
-		c.botClient.Send(tgbotapi.NewMessage(message.Chat.ID, "forward failed...try again?"))
+		c.botClient.Send(tgbotapi.NewMessage(message.Chat.ID, translate(message.From.LanguageCode, "forward_failed")))
 		return err
 	}
-	settings, err := c.storage.GetSettings(context.Background())
+	forwardToChatID := settings.ForwardMessageToChatID
+	forwardID, err := c.sendToReviewGroup(message, forwardToChatID, settings.Anonymous)
+	if to := migratedChatID(err); to != 0 {
+		if e := c.migrateChat(forwardToChatID, to); e != nil {
+			c.logger.Error().Err(e).Send()
+		}
+		forwardToChatID = to
+		forwardID, err = c.sendToReviewGroup(message, forwardToChatID, settings.Anonymous)
+	}
 	if err != nil {
-		c.logger.Error().Err(err).Send()
+		c.logger.Error().Err(err).
+			Int64("forwardToChatID", forwardToChatID).
+			Int64("originChatID", message.Chat.ID).
+			Int("MessageID", message.MessageID).
+			Bool("anonymous", settings.Anonymous).
+			Send()
+		return err
+	}
+	c.markReachable(message.From.ID)
+	// the submission is already in the review group, so a failure here is not the
+	// contributor's to retry
+	msg.ForwardID, msg.Status = forwardID, storage.StatusForward
+	if _, err = c.storage.CreateNewMessage(context.Background(), msg); err != nil {
+		c.logger.Error().Err(err).Str("id", msg.ID).Int("forwardID", forwardID).
+			Msg("record forward id failed, the submission can not be reviewed with buttons")
 	} else {
-		c.forwardToChatID = settings.ForwardMessageToChatID
-		sendm, err := c.botClient.Send(tgbotapi.NewForward(c.forwardToChatID, message.Chat.ID, message.MessageID))
-		if err != nil {
-			c.logger.Error().Err(err).
-				Int64("forwardToChatID", c.forwardToChatID).
-				Int64("originChatID", message.Chat.ID).
-				Int("MessageID", message.MessageID).
-				Send()
-			return err
-		}
-		msg.ForwardID = sendm.MessageID
-		msg.Status = "forward"
-		err = c.storage.UpdateMessageStatus(context.Background(), docRef, msg)
-		if err != nil {
-			c.logger.Error().Err(err).Send()
-		}
-		_, err = c.botClient.Send(tgbotapi.MessageConfig{
-			BaseChat: tgbotapi.BaseChat{
-				ChatID:           message.Chat.ID,
-				ReplyToMessageID: message.MessageID,
-			},
-			Text: settings.Thanks,
-		})
+		c.sendTicket(forwardToChatID, forwardID)
 	}
+	_, err = c.botClient.Send(tgbotapi.MessageConfig{
+		BaseChat: tgbotapi.BaseChat{
+			ChatID:           message.Chat.ID,
+			ReplyToMessageID: message.MessageID,
+		},
+		Text: settings.Localized(languageTag(message.From.LanguageCode)).Thanks,
+	})
 	return err
 }
 
+// sendToReviewGroup forward message to the review group, or in anonymous mode copy it.
+// returns the id admins reply to
+func (c ChatBot) sendToReviewGroup(message *tgbotapi.Message, forwardToChatID int64, anonymous bool) (forwardID int, err error) {
+	if anonymous {
+		return c.copyMessage(CopyMessageConfig{
+			ChatID:     forwardToChatID,
+			FromChatID: message.Chat.ID,
+			MessageID:  message.MessageID,
+		})
+	}
+	sendm, err := c.botClient.Send(tgbotapi.NewForward(forwardToChatID, message.Chat.ID, message.MessageID))
+	return sendm.MessageID, err
+}
+
+// sendTicket label the submission forwarded as forwardID with a ticket number and review buttons
+func (c ChatBot) sendTicket(forwardToChatID int64, forwardID int) {
+	reviewLanguage := c.reviewLanguage()
+	_, err := c.botClient.Send(tgbotapi.MessageConfig{
+		BaseChat: tgbotapi.BaseChat{
+			ChatID:           forwardToChatID,
+			ReplyToMessageID: forwardID,
+			ReplyMarkup:      reviewMarkup(reviewLanguage, forwardID),
+		},
+		Text: ticketText(reviewLanguage, forwardID, storage.StatusForward),
+	})
+	if err != nil {
+		c.logger.Error().Err(err).Int("forwardID", forwardID).Msg("send ticket failed")
+	}
+}
+
 func (c ChatBot) reply(message *tgbotapi.Message) (err error) {
 	originmsg, err := c.storage.GetMessage(context.Background(), message.ReplyToMessage.MessageID)
 	if err != nil {
 		c.logger.Error().Err(err).Send()
-		c.botClient.Send(tgbotapi.NewMessage(message.Chat.ID, "can not found source message"))
+		c.botClient.Send(tgbotapi.NewMessage(message.Chat.ID, translate(message.From.LanguageCode, "source_not_found")))
 		return
 	}
-	_, err = c.botClient.Send(tgbotapi.NewMessage(originmsg.ChatID, message.Text))
+	_, err = c.copyMessage(CopyMessageConfig{
+		ChatID:     originmsg.ChatID,
+		FromChatID: message.Chat.ID,
+		MessageID:  message.MessageID,
+	})
 	if err != nil {
 		c.logger.Error().Err(err).Send()
-		c.botClient.Send(tgbotapi.NewMessage(message.Chat.ID, "reply message failed"))
+		replyText := translate(message.From.LanguageCode, "reply_failed")
+		if isBlockedError(err) {
+			c.markUnreachable(originmsg.UserID, err)
+			replyText = translate(message.From.LanguageCode, "reply_unreachable", err.Error())
+		}
+		c.botClient.Send(tgbotapi.MessageConfig{
+			BaseChat: tgbotapi.BaseChat{
+				ChatID:           message.Chat.ID,
+				ReplyToMessageID: message.MessageID,
+			},
+			Text: replyText,
+		})
 		return
 	}
+	c.markReachable(originmsg.UserID)
 	return
 }
 
-// SetHelpInfo set help info
-func (c ChatBot) setHelpInfo(helpInfo HelpInfo) {
-	c.addCommandHandler("help", func(c ChatBot, message *tgbotapi.Message) (err error) {
-		c.botClient.Send(tgbotapi.NewMessage(message.Chat.ID, helpInfo.String()))
+// cmdHelp /help lists the commands, /help <command> shows usage and examples of one
+func cmdHelp(c ChatBot, message *tgbotapi.Message) (err error) {
+	args := newCommandArgs(message)
+	if args.Len() == 0 {
+		helpInfo := HelpInfo{Commands: botCommands(c.router.roleCommands(c.roleOf(message.From.ID)), message.From.LanguageCode)}
+		if settings, err := c.settings.Get(context.Background()); err == nil {
+			helpInfo.Description = settings.Localized(languageTag(message.From.LanguageCode)).BotInfo
+		}
+		_, err = c.botClient.Send(tgbotapi.NewMessage(message.Chat.ID, helpInfo.String()))
 		return
-	})
+	}
+	name := strings.TrimPrefix(args.String("command"), "/")
+	if err = args.Err(); err != nil {
+		return
+	}
+	languageCode := message.From.LanguageCode
+	text := translate(languageCode, "unknown_command", name)
+	if cmd, ok := c.router.infos[name]; ok {
+		text = cmd.Help(languageCode)
+	}
+	_, err = c.botClient.Send(tgbotapi.NewMessage(message.Chat.ID, text))
+	return
 }
 
-func (c ChatBot) addCommandHandler(cmd string, handler CommandHandler) {
-	if _, ok := c.router.commands[cmd]; ok {
-		c.logger.Fatal().Err(errors.New("already exists handle func")).Send()
+func (c ChatBot) addCallbackHandler(prefix, role string, handler CallbackHandler) {
+	if _, ok := c.callbacks.routes[prefix]; ok {
+		c.logger.Fatal().Err(errors.New("already exists callback handle func")).Str("prefix", prefix).Send()
 	} else {
-		c.router.commands[cmd] = handler
+		c.callbacks.routes[prefix] = callbackRoute{role: role, handler: handler}
 	}
 }
 
+// addCommandHandler register handler for /cmd.Name, wrapped in middlewares.
+// a command with a Role is only run for admins with that role
+func (c ChatBot) addCommandHandler(cmd Command, handler CommandHandler, middlewares ...Middleware) {
+	if _, ok := c.router.commands[cmd.Name]; ok {
+		c.logger.Fatal().Err(errors.New("already exists handle func")).Str("command", cmd.Name).Send()
+		return
+	}
+	if len(cmd.Role) != 0 {
+		middlewares = append([]Middleware{requireRole(cmd.Role)}, middlewares...)
+	}
+	cmd.index = len(c.router.infos)
+	c.router.commands[cmd.Name] = chain(handler, middlewares...)
+	c.router.infos[cmd.Name] = cmd
+}
+
 //HelpInfo help info
 type HelpInfo struct {
 	Description string
@@ -341,32 +530,105 @@ func (h HelpInfo) String() string {
 }
 
 func (c ChatBot) initCommands() {
-	var commands []BotCommand
+	c.addCommandHandler(Command{Name: "start"}, cmdStart)
+	c.addCommandHandler(Command{
+		Name:        "help",
+		Usage:       "[command]",
+		Examples:    []string{"/help", "/help ban"},
+		ReviewGroup: true,
+	}, cmdHelp)
+	c.addCommandHandler(Command{Name: "cancel"}, cmdCancel)
+	c.addCommandHandler(Command{
+		Name:     "settings",
+		Usage:    "[language]",
+		Examples: []string{"/settings", "/settings zh"},
+		Role:     storage.RoleEditor,
+	}, cmdSettings)
+	c.addCommandHandler(Command{
+		Name:        "getchatid",
+		Role:        storage.RoleReviewer,
+		ReviewGroup: true,
+	}, cmdGetChatID)
 
-	// cmd start
-	c.addCommandHandler("start", cmdStart)
-	commands = append(commands, BotCommand{Command: "start", Description: "start use bot"})
+	// admins
+	c.addCommandHandler(Command{
+		Name:        "admins",
+		Role:        storage.RoleReviewer,
+		ReviewGroup: true,
+	}, cmdAdmins)
+	c.addCommandHandler(Command{
+		Name:     "addadmin",
+		Usage:    "<user_id> <owner|editor|reviewer>",
+		Examples: []string{"/addadmin 123456 editor", "reply to a message of the user with /addadmin reviewer"},
+		Role:     storage.RoleOwner,
+	}, cmdAddAdmin)
+	c.addCommandHandler(Command{
+		Name:     "deladmin",
+		Usage:    "<user_id>",
+		Examples: []string{"/deladmin 123456", "reply to a message of the user with /deladmin"},
+		Role:     storage.RoleOwner,
+	}, cmdDelAdmin)
 
-	// cmd settings
-	c.addCommandHandler("settings", cmdSettings)
-	commands = append(commands, BotCommand{Command: "settings", Description: "admin change settings"})
+	// bans
+	c.addCommandHandler(Command{
+		Name:        "ban",
+		Usage:       "<user_id> [duration like 12h or 7d] [reason]",
+		Examples:    []string{"/ban 123456", "/ban 123456 7d spam", "reply to a submission with /ban 12h off topic"},
+		Role:        storage.RoleReviewer,
+		ReviewGroup: true,
+	}, cmdBan)
+	c.addCommandHandler(Command{
+		Name:        "unban",
+		Usage:       "<user_id>",
+		Examples:    []string{"/unban 123456", "reply to a submission with /unban"},
+		Role:        storage.RoleReviewer,
+		ReviewGroup: true,
+	}, cmdUnban)
+	c.addCommandHandler(Command{
+		Name:        "bans",
+		Role:        storage.RoleReviewer,
+		ReviewGroup: true,
+	}, cmdBans)
 
-	// cmd getChatID
-	c.addCommandHandler("getchatid", cmdGetChatID)
-	commands = append(commands, BotCommand{Command: "getchatid", Description: "get chat id"})
+	c.addCommandHandler(Command{
+		Name:        "deadletters",
+		Usage:       "[clear]",
+		Examples:    []string{"/deadletters", "/deadletters clear"},
+		Role:        storage.RoleEditor,
+		ReviewGroup: true,
+	}, cmdDeadLetters)
 
-	var help HelpInfo
-	settings, err := c.storage.GetSettings(context.Background())
-	if err == nil {
-		help.Description = settings.BotInfo
-	}
-	help.Commands = commands
-	c.setHelpInfo(help)
-	c.setMyCommands(commands)
+	// publish queue
+	c.addCommandHandler(Command{
+		Name:        "queue",
+		Role:        storage.RoleEditor,
+		ReviewGroup: true,
+	}, cmdQueue)
+	c.addCommandHandler(Command{
+		Name:        "queue_move",
+		Usage:       "<ticket> <position>",
+		Examples:    []string{"/queue_move 42 1"},
+		Role:        storage.RoleEditor,
+		ReviewGroup: true,
+	}, cmdQueueMove)
+
+}
+
+func (c ChatBot) initCallbacks() {
+	// review buttons on tickets
+	c.addCallbackHandler(reviewCallbackPrefix, storage.RoleReviewer, cbReview)
+
+	// settings menu
+	c.addCallbackHandler(settingsCallbackPrefix, storage.RoleEditor, cbChangeSetting)
+	c.addCallbackHandler(callbackData(settingsCallbackPrefix, "anonymous"), storage.RoleEditor, cbToggleAnonymous)
+	c.addCallbackHandler(callbackData(settingsCallbackPrefix, "done"), storage.RoleEditor, cbSettingsDone)
 }
 
 func (c ChatBot) cleanmessages(ctx *gin.Context) {
 	err := c.storage.DeleteOldForwardMessages(context.Background())
+	if err == nil {
+		err = c.storage.DeleteExpiredCounters(context.Background(), time.Now())
+	}
 	if err != nil {
 		c.logger.Error().Err(err).Send()
 		ctx.JSON(200, "failed")
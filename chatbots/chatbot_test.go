@@ -0,0 +1,143 @@
+package chatbots
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/doylecnn/contribution_bot/storage"
+	"github.com/doylecnn/contribution_bot/telegramtest"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+const (
+	testReviewGroupID = -1001
+	testContributorID = 42
+	testAdminID       = 7
+)
+
+// newTestChatBot a bot talking to a fake telegram server, backed by memory storage
+func newTestChatBot(t *testing.T, settings storage.Settings) (*telegramtest.Server, storage.Storage, ChatBot) {
+	return newTestChatBotWith(t, storage.NewMemoryStorage(), settings)
+}
+
+// newTestChatBotWith a bot talking to a fake telegram server, backed by s
+func newTestChatBotWith(t *testing.T, s storage.Storage, settings storage.Settings) (*telegramtest.Server, storage.Storage, ChatBot) {
+	server := telegramtest.NewServer()
+	t.Cleanup(server.Close)
+	client, err := server.NewClient("test-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.SaveSettings(context.Background(), settings); err != nil {
+		t.Fatal(err)
+	}
+	c := NewChatBot(Config{
+		Client: client,
+		Pacing: &SendPacing{Sleep: func(time.Duration) {}},
+	}, s)
+	server.Reset()
+	return server, s, c
+}
+
+func TestForwardReplyDelivery(t *testing.T) {
+	server, s, c := newTestChatBot(t, storage.Settings{
+		ForwardMessageToChatID: testReviewGroupID,
+		Thanks:                 "thanks",
+	})
+	contributor := &tgbotapi.User{ID: testContributorID, FirstName: "alice", LanguageCode: "en"}
+	admin := &tgbotapi.User{ID: testAdminID, FirstName: "bob", LanguageCode: "en"}
+
+	// the contributor submits a message
+	c.handleUpdate(tgbotapi.Update{Message: &tgbotapi.Message{
+		MessageID: 10,
+		From:      contributor,
+		Chat:      &tgbotapi.Chat{ID: testContributorID, Type: "private"},
+		Date:      int(time.Now().Unix()),
+		Text:      "hello",
+	}})
+
+	msg, err := s.GetLatestMessage(context.Background(), testContributorID)
+	if err != nil {
+		t.Fatalf("submission not stored: %v", err)
+	}
+	if msg.Status != storage.StatusForward || msg.ChatID != testContributorID || msg.MessageID != 10 {
+		t.Errorf("stored submission = %+v", msg)
+	}
+	toGroup := server.Sent(testReviewGroupID)
+	if len(toGroup) != 2 {
+		t.Fatalf("review group got %d messages, want the submission and its ticket", len(toGroup))
+	}
+	if r := toGroup[0]; r.Method != "forwardMessage" ||
+		r.Params.Get("from_chat_id") != strconv.Itoa(testContributorID) || r.Params.Get("message_id") != "10" {
+		t.Errorf("submission sent as %s %v", r.Method, r.Params)
+	}
+	if r := toGroup[1]; r.Params.Get("reply_to_message_id") != strconv.Itoa(msg.ForwardID) ||
+		len(r.Params.Get("reply_markup")) == 0 {
+		t.Errorf("ticket sent as %s %v", r.Method, r.Params)
+	}
+	toContributor := server.Sent(testContributorID)
+	if len(toContributor) != 1 || toContributor[0].Params.Get("text") != "thanks" {
+		t.Fatalf("contributor got %v, want the thanks", toContributor)
+	}
+
+	// an admin replies to the forwarded message in the review group
+	server.Reset()
+	c.handleUpdate(tgbotapi.Update{Message: &tgbotapi.Message{
+		MessageID:      500,
+		From:           admin,
+		Chat:           &tgbotapi.Chat{ID: testReviewGroupID, Type: "supergroup"},
+		Date:           int(time.Now().Unix()),
+		Text:           "thank you, will publish",
+		ReplyToMessage: &tgbotapi.Message{MessageID: msg.ForwardID},
+	}})
+
+	toContributor = server.Sent(testContributorID)
+	if len(toContributor) != 1 {
+		t.Fatalf("contributor got %d messages, want the reply", len(toContributor))
+	}
+	if r := toContributor[0]; r.Method != "copyMessage" ||
+		r.Params.Get("from_chat_id") != strconv.Itoa(testReviewGroupID) || r.Params.Get("message_id") != "500" {
+		t.Errorf("reply delivered as %s %v", r.Method, r.Params)
+	}
+	if toGroup = server.Sent(testReviewGroupID); len(toGroup) != 0 {
+		t.Errorf("review group got %v, want no error notice", toGroup)
+	}
+}
+
+// failingForwardStorage fails to record forwarded messages
+type failingForwardStorage struct {
+	storage.Storage
+}
+
+func (s failingForwardStorage) CreateNewMessage(ctx context.Context, message storage.Message) (string, error) {
+	if message.ForwardID != 0 {
+		return "", errors.New("unavailable")
+	}
+	return s.Storage.CreateNewMessage(ctx, message)
+}
+
+func TestForwardRecordFailed(t *testing.T) {
+	server, _, c := newTestChatBotWith(t, failingForwardStorage{storage.NewMemoryStorage()}, storage.Settings{
+		ForwardMessageToChatID: testReviewGroupID,
+		Thanks:                 "thanks",
+	})
+	c.handleUpdate(tgbotapi.Update{Message: &tgbotapi.Message{
+		MessageID: 10,
+		From:      &tgbotapi.User{ID: testContributorID, FirstName: "alice", LanguageCode: "en"},
+		Chat:      &tgbotapi.Chat{ID: testContributorID, Type: "private"},
+		Date:      int(time.Now().Unix()),
+		Text:      "hello",
+	}})
+
+	// the submission reached the review group, but no ticket refers to an unrecorded forward
+	if toGroup := server.Sent(testReviewGroupID); len(toGroup) != 1 || toGroup[0].Method != "forwardMessage" {
+		t.Errorf("review group got %v, want only the submission", toGroup)
+	}
+	// and the contributor is not asked to send it again
+	if toContributor := server.Sent(testContributorID); len(toContributor) != 1 || toContributor[0].Params.Get("text") != "thanks" {
+		t.Errorf("contributor got %v, want the thanks", toContributor)
+	}
+}
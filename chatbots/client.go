@@ -0,0 +1,20 @@
+package chatbots
+
+import (
+	"net/url"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// TelegramClient is the part of the telegram bot api the bot uses.
+// *tgbotapi.BotAPI satisfies it; tests can point one at a telegramtest.Server.
+type TelegramClient interface {
+	Send(c tgbotapi.Chattable) (tgbotapi.Message, error)
+	DeleteMessage(config tgbotapi.DeleteMessageConfig) (tgbotapi.APIResponse, error)
+	AnswerCallbackQuery(config tgbotapi.CallbackConfig) (tgbotapi.APIResponse, error)
+	GetWebhookInfo() (tgbotapi.WebhookInfo, error)
+	MakeRequest(endpoint string, params url.Values) (tgbotapi.APIResponse, error)
+	UploadFile(endpoint string, params map[string]string, fieldname string, file interface{}) (tgbotapi.APIResponse, error)
+}
+
+var _ TelegramClient = (*tgbotapi.BotAPI)(nil)
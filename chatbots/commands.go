@@ -3,58 +3,144 @@ package chatbots
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 
+	"github.com/doylecnn/contribution_bot/storage"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
 )
 
 func cmdStart(c ChatBot, message *tgbotapi.Message) (err error) {
-	settings, err := c.storage.GetSettings(context.Background())
+	settings, err := c.settings.Get(context.Background())
 	if err != nil {
-		_, err = c.botClient.Send(tgbotapi.NewMessage(message.Chat.ID, "请先使用 /settings 修改设置"))
+		_, err = c.botClient.Send(tgbotapi.NewMessage(message.Chat.ID, translate(message.From.LanguageCode, "need_settings")))
 		return
 	}
-	_, err = c.botClient.Send(tgbotapi.NewMessage(message.Chat.ID, settings.BotInfo))
+	texts := settings.Localized(languageTag(message.From.LanguageCode))
+	_, err = c.botClient.Send(tgbotapi.NewMessage(message.Chat.ID, texts.BotInfo))
 	if err != nil {
 		return
 	}
-	_, err = c.botClient.Send(tgbotapi.NewMessage(message.Chat.ID, settings.WelcomeWords))
+	_, err = c.botClient.Send(tgbotapi.NewMessage(message.Chat.ID, texts.WelcomeWords))
 	return
 }
 
+// cmdSettings /settings shows the settings menu, /settings <language> edits
+// the texts contributors of that language see
 func cmdSettings(c ChatBot, message *tgbotapi.Message) (err error) {
-	if message.From.ID != c.adminID {
+	args := newCommandArgs(message)
+	var textsLanguage string
+	if args.Len() > 0 {
+		if textsLanguage = strings.ToLower(args.String("language")); !validLanguage(textsLanguage) {
+			args.Fail("unknown_language", textsLanguage)
+		}
+	}
+	if err = args.Err(); err != nil {
 		return
 	}
-	settings, _ := c.storage.GetSettings(context.Background())
+	settings, _ := c.settings.Get(context.Background())
+	languageCode := message.From.LanguageCode
 	_, err = c.botClient.Send(tgbotapi.MessageConfig{
 		BaseChat: tgbotapi.BaseChat{
 			ChatID:      message.Chat.ID,
-			ReplyMarkup: settingsMarkup(),
+			ReplyMarkup: settingsMarkup(languageCode, textsLanguage),
 		},
-		Text: "change settings\n" + settings.String(),
+		Text: settingsText(languageCode, textsLanguage, translate(languageCode, "change_settings", settingsString(languageCode, settings))),
 	})
 	return
 }
 
-func settingsMarkup() (replyMarkup tgbotapi.InlineKeyboardMarkup) {
-	changeWelcomeWordsBtn := tgbotapi.NewInlineKeyboardButtonData("change welcome words", "/change_welcome_words")
-	changeBotInfoBtn := tgbotapi.NewInlineKeyboardButtonData("change bot info", "/change_bot_info")
-	changeThanksBtn := tgbotapi.NewInlineKeyboardButtonData("change thanks words", "/change_thanks")
-	changeForwardToChatIDBtn := tgbotapi.NewInlineKeyboardButtonData("change forward to chat id", "/change_forward_to_chat_id")
-	settingsDoneBtn := tgbotapi.NewInlineKeyboardButtonData("done", "/change_done")
+// settingsString settings and their translated texts, labeled in the language of languageCode
+func settingsString(languageCode string, settings storage.Settings) string {
+	reviewLanguage := settings.ReviewLanguage
+	if len(reviewLanguage) == 0 {
+		reviewLanguage = defaultLanguage
+	}
+	text := translate(languageCode, "settings",
+		settings.BotInfo,
+		settings.WelcomeWords,
+		settings.Thanks,
+		settings.ForwardMessageToChatID,
+		settings.PublishChannelID,
+		settings.PublishSchedule,
+		settings.RateLimitPerMinute,
+		settings.RateLimitPerDay,
+		settings.Anonymous,
+		reviewLanguage,
+	)
+	languages := make([]string, 0, len(settings.Texts))
+	for language := range settings.Texts {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+	for _, language := range languages {
+		texts := settings.Texts[language]
+		text += "\n\n" + translate(languageCode, "settings_texts", language, texts.BotInfo, texts.WelcomeWords, texts.Thanks)
+	}
+	return text
+}
+
+// settingsText text above the settings menu, noting the language texts are edited for
+func settingsText(languageCode, textsLanguage, text string) string {
+	if len(textsLanguage) != 0 {
+		text += "\n\n" + translate(languageCode, "editing_texts", textsLanguage)
+	}
+	return text
+}
+
+// settingsMarkup settings menu in the language of languageCode, the text buttons
+// edit the texts of textsLanguage, or the default texts when it is empty
+func settingsMarkup(languageCode, textsLanguage string) (replyMarkup tgbotapi.InlineKeyboardMarkup) {
+	// buttons withLanguage keep textsLanguage in their callback data
+	button := func(field string, withLanguage bool) tgbotapi.InlineKeyboardButton {
+		data := callbackData(settingsCallbackPrefix, field)
+		if withLanguage && len(textsLanguage) != 0 {
+			data = callbackData(settingsCallbackPrefix, field, textsLanguage)
+		}
+		return tgbotapi.NewInlineKeyboardButtonData(translate(languageCode, "btn_"+field), data)
+	}
+	changeWelcomeWordsBtn := button("welcome_words", true)
+	changeBotInfoBtn := button("bot_info", true)
+	changeThanksBtn := button("thanks", true)
+	changeForwardToChatIDBtn := button("forward_to_chat_id", false)
+	changePublishChannelIDBtn := button("publish_channel_id", false)
+	changePublishScheduleBtn := button("publish_schedule", false)
+	changeRateLimitsBtn := button("rate_limits", false)
+	changeReviewLanguageBtn := button("review_language", false)
+	toggleAnonymousBtn := button("anonymous", true)
+	settingsDoneBtn := button("done", false)
 	return tgbotapi.NewInlineKeyboardMarkup(
 		tgbotapi.NewInlineKeyboardRow(changeWelcomeWordsBtn),
 		tgbotapi.NewInlineKeyboardRow(changeBotInfoBtn),
 		tgbotapi.NewInlineKeyboardRow(changeThanksBtn),
 		tgbotapi.NewInlineKeyboardRow(changeForwardToChatIDBtn),
+		tgbotapi.NewInlineKeyboardRow(changePublishChannelIDBtn),
+		tgbotapi.NewInlineKeyboardRow(changePublishScheduleBtn),
+		tgbotapi.NewInlineKeyboardRow(changeRateLimitsBtn),
+		tgbotapi.NewInlineKeyboardRow(changeReviewLanguageBtn),
+		tgbotapi.NewInlineKeyboardRow(toggleAnonymousBtn),
 		tgbotapi.NewInlineKeyboardRow(settingsDoneBtn),
 	)
 }
 
-func cmdGetChatID(c ChatBot, message *tgbotapi.Message) (err error) {
-	if message.From.ID != c.adminID {
-		return
+// deadLetterChat the chat a dead letter was for. in anonymous mode a private chat, whose
+// id is the contributor's, is only referred to by the ticket of their latest submission
+func (c ChatBot) deadLetterChat(languageCode string, chatID int64, anonymous bool) string {
+	if !anonymous || chatID < 0 {
+		return strconv.FormatInt(chatID, 10)
+	}
+	latest, err := c.storage.GetLatestMessage(context.Background(), int(chatID))
+	if err != nil {
+		if err != storage.ErrMessageNotFound {
+			c.logger.Error().Err(err).Send()
+		}
+		return translate(languageCode, "some_contributor")
 	}
+	return translate(languageCode, "ticket_ref", latest.ForwardID)
+}
+
+func cmdGetChatID(c ChatBot, message *tgbotapi.Message) (err error) {
 	_, err = c.botClient.Send(tgbotapi.MessageConfig{
 		BaseChat: tgbotapi.BaseChat{
 			ChatID: message.Chat.ID,
@@ -63,3 +149,44 @@ func cmdGetChatID(c ChatBot, message *tgbotapi.Message) (err error) {
 	})
 	return
 }
+
+// cmdDeadLetters /deadletters shows the latest messages that failed to send,
+// /deadletters clear deletes them
+func cmdDeadLetters(c ChatBot, message *tgbotapi.Message) (err error) {
+	args := newCommandArgs(message)
+	clear := false
+	if args.Len() > 0 {
+		if action := args.String("action"); action == "clear" {
+			clear = true
+		} else {
+			args.Fail("unknown_action", action)
+		}
+	}
+	if err = args.Err(); err != nil {
+		return
+	}
+	if clear {
+		if err = c.storage.ClearDeadLetters(context.Background()); err != nil {
+			return
+		}
+		_, err = c.botClient.Send(tgbotapi.NewMessage(message.Chat.ID, translate(message.From.LanguageCode, "dead_letters_cleared")))
+		return
+	}
+	letters, err := c.storage.ListDeadLetters(context.Background(), 10)
+	if err != nil {
+		return
+	}
+	text := translate(message.From.LanguageCode, "no_dead_letters")
+	if len(letters) > 0 {
+		anonymous := c.anonymous()
+		lines := make([]string, len(letters))
+		for i, letter := range letters {
+			lines[i] = translate(message.From.LanguageCode, "dead_letter",
+				letter.FailedAt.UTC().Format("01-02 15:04"), letter.Method,
+				c.deadLetterChat(message.From.LanguageCode, letter.ChatID, anonymous), letter.Error)
+		}
+		text = strings.Join(lines, "\n") + "\n\n" + translate(message.From.LanguageCode, "dead_letters_hint")
+	}
+	_, err = c.botClient.Send(tgbotapi.NewMessage(message.Chat.ID, text))
+	return
+}
@@ -0,0 +1,55 @@
+package chatbots
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/doylecnn/contribution_bot/storage"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+func TestDeadLettersAnonymous(t *testing.T) {
+	tests := []struct {
+		anonymous bool
+		shown     string
+		hidden    string
+	}{
+		{false, "to 42:", "ticket"},
+		{true, "the contributor of ticket #100", "to 42"},
+	}
+	for _, tt := range tests {
+		server, s, c := newTestChatBot(t, storage.Settings{ForwardMessageToChatID: testReviewGroupID, Anonymous: tt.anonymous})
+		ctx := context.Background()
+		_, err := s.CreateNewMessage(ctx, storage.Message{UserID: testContributorID, ChatID: testContributorID,
+			MessageID: 1, ForwardID: 100, Time: time.Now(), Status: storage.StatusForward})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = s.SaveDeadLetter(ctx, storage.DeadLetter{Method: "copyMessage", ChatID: testContributorID,
+			Error: "Forbidden: bot was blocked by the user", FailedAt: time.Now()})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = cmdDeadLetters(c, &tgbotapi.Message{
+			MessageID: 1,
+			From:      &tgbotapi.User{ID: testAdminID, LanguageCode: "en"},
+			Chat:      &tgbotapi.Chat{ID: testReviewGroupID, Type: "supergroup"},
+			Text:      "/deadletters",
+			Entities:  &[]tgbotapi.MessageEntity{{Type: "bot_command", Length: len("/deadletters")}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sent := server.Sent(testReviewGroupID)
+		if len(sent) != 1 {
+			t.Fatalf("anonymous %v: review group got %v", tt.anonymous, sent)
+		}
+		text := sent[0].Params.Get("text")
+		if !strings.Contains(text, tt.shown) || strings.Contains(text, tt.hidden) {
+			t.Errorf("anonymous %v: %q, want %q and not %q", tt.anonymous, text, tt.shown, tt.hidden)
+		}
+	}
+}
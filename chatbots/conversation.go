@@ -0,0 +1,217 @@
+package chatbots
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/doylecnn/contribution_bot/storage"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// conversationTTL how long the bot waits for an admin to send the value it asked for
+const conversationTTL = 10 * time.Minute
+
+// settingsStatePrefix conversation state of an admin changing a setting, followed by
+// the field and for texts ":<language>"
+const settingsStatePrefix = "settings:"
+
+// settingsField a setting editors change by sending its new value
+type settingsField struct {
+	// prompt catalog key of the question asking for the value
+	prompt string
+	// apply set the value, language is the one texts are edited for, empty for the default texts
+	apply func(settings *storage.Settings, language, text string) error
+}
+
+// settingsFields by the name used in /change_<name> callbacks
+var settingsFields = map[string]settingsField{
+	"welcome_words": {"prompt_welcome_words", func(settings *storage.Settings, language, text string) error {
+		setTexts(settings, language, func(texts *storage.SettingsTexts) { texts.WelcomeWords = text })
+		return nil
+	}},
+	"bot_info": {"prompt_bot_info", func(settings *storage.Settings, language, text string) error {
+		setTexts(settings, language, func(texts *storage.SettingsTexts) { texts.BotInfo = text })
+		return nil
+	}},
+	"thanks": {"prompt_thanks", func(settings *storage.Settings, language, text string) error {
+		setTexts(settings, language, func(texts *storage.SettingsTexts) { texts.Thanks = text })
+		return nil
+	}},
+	"forward_to_chat_id": {"prompt_forward_to_chat_id", func(settings *storage.Settings, language, text string) error {
+		chatID, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			return catalogError{key: "not_chat_id", args: []interface{}{text}}
+		}
+		settings.ForwardMessageToChatID = chatID
+		return nil
+	}},
+	"publish_channel_id": {"prompt_publish_channel_id", func(settings *storage.Settings, language, text string) error {
+		chatID, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			return catalogError{key: "not_chat_id", args: []interface{}{text}}
+		}
+		settings.PublishChannelID = chatID
+		return nil
+	}},
+	"publish_schedule": {"prompt_publish_schedule", func(settings *storage.Settings, language, text string) error {
+		if _, err := parseSchedule(text); err != nil {
+			return err
+		}
+		settings.PublishSchedule = text
+		return nil
+	}},
+	"rate_limits": {"prompt_rate_limits", func(settings *storage.Settings, language, text string) error {
+		var perMinute, perDay int
+		if _, err := fmt.Sscanf(text, "%d %d", &perMinute, &perDay); err != nil || perMinute < 0 || perDay < 0 {
+			return catalogError{key: "not_rate_limits", args: []interface{}{text}}
+		}
+		settings.RateLimitPerMinute = perMinute
+		settings.RateLimitPerDay = perDay
+		return nil
+	}},
+	"review_language": {"prompt_review_language", func(settings *storage.Settings, language, text string) error {
+		if lang := strings.ToLower(text); validLanguage(lang) {
+			settings.ReviewLanguage = lang
+			return nil
+		}
+		return catalogError{key: "unknown_language", args: []interface{}{text}}
+	}},
+}
+
+// setTexts change the texts contributors of language see, the default texts when language is empty
+func setTexts(settings *storage.Settings, language string, set func(texts *storage.SettingsTexts)) {
+	if len(language) == 0 {
+		texts := storage.SettingsTexts{BotInfo: settings.BotInfo, WelcomeWords: settings.WelcomeWords, Thanks: settings.Thanks}
+		set(&texts)
+		settings.BotInfo, settings.WelcomeWords, settings.Thanks = texts.BotInfo, texts.WelcomeWords, texts.Thanks
+		return
+	}
+	if settings.Texts == nil {
+		settings.Texts = make(map[string]storage.SettingsTexts)
+	}
+	texts := settings.Texts[language]
+	set(&texts)
+	settings.Texts[language] = texts
+}
+
+// settingsPrompt question asking user for the value of field, in the user's language
+func settingsPrompt(languageCode string, field settingsField, textsLanguage string) string {
+	prompt := translate(languageCode, field.prompt)
+	if len(textsLanguage) != 0 {
+		prompt = translate(languageCode, "prompt_language", prompt, textsLanguage)
+	}
+	return prompt + "\n" + translate(languageCode, "cancel_hint")
+}
+
+// askSettingsField remember the admin is changing field, of the texts of textsLanguage
+// when not empty, and ask for the new value
+func (c ChatBot) askSettingsField(user *tgbotapi.User, field, textsLanguage string) (err error) {
+	state := settingsStatePrefix + field
+	if len(textsLanguage) != 0 {
+		state += ":" + textsLanguage
+	}
+	err = c.storage.SaveConversation(context.Background(), storage.Conversation{
+		UserID:    user.ID,
+		State:     state,
+		ExpiresAt: time.Now().Add(conversationTTL),
+	})
+	if err != nil {
+		return
+	}
+	_, err = c.botClient.Send(tgbotapi.MessageConfig{
+		BaseChat: tgbotapi.BaseChat{
+			ChatID:      int64(user.ID),
+			ReplyMarkup: tgbotapi.ForceReply{ForceReply: true, Selective: true},
+		},
+		Text: settingsPrompt(user.LanguageCode, settingsFields[field], textsLanguage),
+	})
+	return
+}
+
+// continueConversation handle the message as the answer the bot waits for from the user.
+// returns false when the bot is not waiting for anything
+func (c ChatBot) continueConversation(message *tgbotapi.Message) bool {
+	conversation, err := c.storage.GetConversation(context.Background(), message.From.ID)
+	if err != nil {
+		if err != storage.ErrConversationNotFound {
+			c.logger.Error().Err(err).Int("userID", message.From.ID).Send()
+		}
+		return false
+	}
+	if conversation.Expired(time.Now()) || !strings.HasPrefix(conversation.State, settingsStatePrefix) ||
+		!c.hasRole(message.From.ID, storage.RoleEditor) {
+		c.endConversation(message.From.ID)
+		return false
+	}
+	name := strings.TrimPrefix(conversation.State, settingsStatePrefix)
+	var textsLanguage string
+	if i := strings.Index(name, ":"); i != -1 {
+		name, textsLanguage = name[:i], name[i+1:]
+	}
+	field, ok := settingsFields[name]
+	if !ok {
+		c.endConversation(message.From.ID)
+		return false
+	}
+
+	// photos, stickers and blank messages would clear the setting
+	var settings storage.Settings
+	text := strings.TrimSpace(message.Text)
+	if len(text) == 0 {
+		err = catalogError{key: "not_text"}
+	} else {
+		settings, err = c.settings.Update(context.Background(), func(settings *storage.Settings) error {
+			return field.apply(settings, textsLanguage, text)
+		})
+	}
+	languageCode := message.From.LanguageCode
+	var replyText string
+	var replyMarkup interface{}
+	if err != nil {
+		// keep waiting, the admin can send a corrected value or /cancel
+		c.logger.Warn().Err(err).Int("userID", message.From.ID).Msg("invalid setting")
+		replyText = translate(languageCode, "update_failed_error", errorText(languageCode, err)) + "\n" +
+			settingsPrompt(languageCode, field, textsLanguage)
+		replyMarkup = tgbotapi.ForceReply{ForceReply: true, Selective: true}
+	} else {
+		c.endConversation(message.From.ID)
+		replyText = settingsText(languageCode, textsLanguage, translate(languageCode, "update_success", settingsString(languageCode, settings)))
+		replyMarkup = settingsMarkup(languageCode, textsLanguage)
+	}
+	_, err = c.botClient.Send(tgbotapi.MessageConfig{
+		BaseChat: tgbotapi.BaseChat{
+			ChatID:           message.Chat.ID,
+			ReplyToMessageID: message.MessageID,
+			ReplyMarkup:      replyMarkup,
+		},
+		Text: replyText,
+	})
+	if err != nil {
+		c.logger.Error().Err(err).Send()
+	}
+	return true
+}
+
+func (c ChatBot) endConversation(userID int) {
+	if err := c.storage.DeleteConversation(context.Background(), userID); err != nil {
+		c.logger.Error().Err(err).Int("userID", userID).Send()
+	}
+}
+
+// cmdCancel stop whatever the bot waits for the user to send
+func cmdCancel(c ChatBot, message *tgbotapi.Message) (err error) {
+	replyText := translate(message.From.LanguageCode, "nothing_to_cancel")
+	if _, err = c.storage.GetConversation(context.Background(), message.From.ID); err == nil {
+		if err = c.storage.DeleteConversation(context.Background(), message.From.ID); err != nil {
+			return
+		}
+		replyText = translate(message.From.LanguageCode, "cancelled")
+	} else if err != storage.ErrConversationNotFound {
+		return
+	}
+	_, err = c.botClient.Send(tgbotapi.NewMessage(message.Chat.ID, replyText))
+	return
+}
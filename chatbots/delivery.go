@@ -0,0 +1,101 @@
+package chatbots
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/doylecnn/contribution_bot/storage"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// migratedChatID the supergroup a group was upgraded to, when err says so
+func migratedChatID(err error) int64 {
+	if apiErr, ok := err.(tgbotapi.Error); ok {
+		return apiErr.MigrateToChatID
+	}
+	return 0
+}
+
+// isBlockedError telegram answered 403, e.g. the user blocked the bot or deleted the account
+func isBlockedError(err error) bool {
+	apiErr, ok := err.(tgbotapi.Error)
+	return ok && strings.HasPrefix(apiErr.Message, "Forbidden")
+}
+
+// migrateChat point settings that use the chat from at the supergroup to
+func (c ChatBot) migrateChat(from, to int64) (err error) {
+	settings, err := c.settings.Get(context.Background())
+	if err != nil {
+		return
+	}
+	if settings.ForwardMessageToChatID != from && settings.PublishChannelID != from {
+		return
+	}
+	_, err = c.settings.Update(context.Background(), func(settings *storage.Settings) error {
+		if settings.ForwardMessageToChatID == from {
+			settings.ForwardMessageToChatID = to
+		}
+		if settings.PublishChannelID == from {
+			settings.PublishChannelID = to
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	c.logger.Info().Int64("from", from).Int64("to", to).Msg("chat migrated to supergroup, settings updated")
+	return
+}
+
+// markUnreachable record why messages to the contributor fail
+func (c ChatBot) markUnreachable(userID int, reason error) {
+	since := time.Now()
+	// keep when the contributor first became unreachable
+	if contributor, err := c.storage.GetContributor(context.Background(), userID); err == nil && len(contributor.Unreachable) != 0 {
+		since = contributor.UnreachableSince
+	}
+	err := c.storage.SaveContributor(context.Background(), storage.Contributor{
+		UserID:           userID,
+		Unreachable:      reason.Error(),
+		UnreachableSince: since,
+	})
+	if err != nil {
+		c.logger.Error().Err(err).Int("userID", userID).Send()
+	}
+}
+
+// unreachableNote a line telling reviewers since when and why the contributor can not be reached, empty if they can
+func (c ChatBot) unreachableNote(languageCode string, userID int) string {
+	contributor, err := c.storage.GetContributor(context.Background(), userID)
+	if err != nil {
+		if err != storage.ErrContributorNotFound {
+			c.logger.Error().Err(err).Int("userID", userID).Send()
+		}
+		return ""
+	}
+	if len(contributor.Unreachable) == 0 {
+		return ""
+	}
+	return "\n" + translate(languageCode, "unreachable",
+		contributor.UnreachableSince.UTC().Format("2006-01-02 15:04 UTC"), contributor.Unreachable)
+}
+
+// markReachable clear the unreachable mark of a contributor we could talk to again
+func (c ChatBot) markReachable(userID int) {
+	contributor, err := c.storage.GetContributor(context.Background(), userID)
+	if err != nil {
+		if err != storage.ErrContributorNotFound {
+			c.logger.Error().Err(err).Int("userID", userID).Send()
+		}
+		return
+	}
+	if len(contributor.Unreachable) == 0 {
+		return
+	}
+	contributor.Unreachable = ""
+	contributor.UnreachableSince = time.Time{}
+	if err = c.storage.SaveContributor(context.Background(), contributor); err != nil {
+		c.logger.Error().Err(err).Int("userID", userID).Send()
+	}
+}
@@ -0,0 +1,336 @@
+package chatbots
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// defaultLanguage used when the user's language has no translation
+const defaultLanguage = "en"
+
+// catalog message templates by language code and key, formatted with fmt.
+// every key is in the default language, other languages may leave some out
+var catalog = map[string]map[string]string{
+	"en": {
+		// commands and help
+		"unknown_command":    "unknown command /%s, see /help",
+		"usage":              "usage: %s",
+		"examples":           "examples:",
+		"more_help":          "see /help %s for examples",
+		"required_role":      "for %s and above",
+		"missing_arg":        "missing %s",
+		"not_a_number":       "%s %q is not a number",
+		"unexpected_args":    "unexpected %q",
+		"too_many_commands":  "too many commands, please wait a minute and try again.",
+		"cancelled":          "cancelled",
+		"nothing_to_cancel":  "nothing to cancel",
+		"permission_denied":  "permission denied",
+		"button_unsupported": "this button is no longer supported",
+
+		// command descriptions in /help and the command menu
+		"cmd_start":       "start use bot",
+		"cmd_help":        "show commands, or usage and examples of one",
+		"cmd_cancel":      "cancel the current operation",
+		"cmd_settings":    "admin change settings, or the texts of one language",
+		"cmd_getchatid":   "get chat id",
+		"cmd_admins":      "admin list admins",
+		"cmd_addadmin":    "owner add admin or change role",
+		"cmd_deladmin":    "owner remove admin",
+		"cmd_ban":         "admin ban a contributor",
+		"cmd_unban":       "admin lift a ban",
+		"cmd_bans":        "admin list banned users",
+		"cmd_deadletters": "admin show messages that failed to send",
+		"cmd_queue":       "admin show publish queue",
+		"cmd_queue_move":  "admin reorder publish queue",
+
+		// submissions
+		"need_settings":         "please set up the bot with /settings first",
+		"forward_failed":        "forward failed...try again?",
+		"too_fast":              "you are sending messages too fast, please wait a minute and try again.",
+		"daily_limit":           "you have reached today's submission limit, thank you! please come back tomorrow.",
+		"flood_alert":           "%s (%d) keeps hitting the rate limit, %d messages dropped today.\nuse /ban %d to block this user.",
+		"flood_alert_anonymous": "the contributor of ticket #%d keeps hitting the rate limit, %d messages dropped today.\nreply /ban to their submission to block them.",
+		"flood_alert_unknown":   "a contributor keeps hitting the rate limit, %d messages dropped today.",
+		"notice_approved":       "your submission has been approved and will be published soon.",
+		"notice_rejected":       "sorry, your submission was not accepted.",
+		"notice_changes":        "the editors asked for changes to your submission, please send a revised version.",
+		"notice_published":      "your submission has been published, thank you!",
+		"source_not_found":      "can not find the source message",
+		"reply_failed":          "reply message failed",
+		"reply_unreachable":     "reply message failed, the contributor can not be reached: %s",
+
+		// review
+		"btn_approve":    "approve",
+		"btn_reject":     "reject",
+		"btn_changes":    "request changes",
+		"ticket":         "ticket #%d\nstatus: %s",
+		"reviewed_by":    "by %s",
+		"unreachable":    "the contributor can not be reached since %s: %s",
+		"already":        "already %s",
+		"approve_failed": "approve failed: %s",
+
+		"status_unread":            "unread",
+		"status_forward":           "waiting for review",
+		"status_approved":          "approved",
+		"status_rejected":          "rejected",
+		"status_changes_requested": "changes requested",
+		"status_published":         "published",
+		"status_publish_failed":    "publish failed",
+
+		// settings
+		"settings":       "bot info: %s\nwelcome words: %s\nthanks words: %s\nforward to: %d\npublish to: %d\npublish schedule: %s\nrate limit: %d/minute %d/day\nanonymous: %t\nreview group language: %s",
+		"settings_texts": "[%s]\nbot info: %s\nwelcome words: %s\nthanks words: %s",
+
+		"change_settings":           "change settings\n%s",
+		"editing_texts":             "texts are edited for language %s",
+		"unknown_language":          "%q is not a language code like en or zh",
+		"update_success":            "update success\n%s",
+		"update_failed":             "update failed",
+		"update_failed_error":       "update failed\n error: %s",
+		"update_request_received":   "update request received",
+		"done":                      "done",
+		"unknown_setting":           "unknown setting",
+		"anonymous_state":           "anonymous: %t",
+		"cancel_hint":               "/cancel to keep the current value",
+		"btn_welcome_words":         "change welcome words",
+		"btn_bot_info":              "change bot info",
+		"btn_thanks":                "change thanks words",
+		"btn_forward_to_chat_id":    "change forward to chat id",
+		"btn_publish_channel_id":    "change publish channel id",
+		"btn_publish_schedule":      "change publish schedule",
+		"btn_rate_limits":           "change rate limits",
+		"btn_review_language":       "change review group language",
+		"btn_anonymous":             "toggle anonymous mode",
+		"btn_done":                  "done",
+		"prompt_welcome_words":      "send the new welcome words",
+		"prompt_bot_info":           "send the new bot info",
+		"prompt_thanks":             "send the new thanks words",
+		"prompt_forward_to_chat_id": "send the id of the chat submissions are forwarded to, /getchatid in that chat shows it",
+		"prompt_publish_channel_id": "send the id of the channel approved submissions are published to",
+		"prompt_publish_schedule":   "send the publish schedule, an interval like 3h or daily times like 09:00,18:00 Asia/Shanghai",
+		"prompt_rate_limits":        "send the rate limits, per minute and per day, e.g. 5 50. 0 means no limit",
+		"prompt_review_language":    "send the language of tickets, review buttons and alerts in the review group, a code like en or zh",
+		"prompt_language":           "%s [%s]",
+		"not_chat_id":               "%q is not a chat id",
+		"not_text":                  "the new value must be sent as text",
+		"not_rate_limits":           "%q is not two numbers like 5 50",
+
+		// admins and bans
+		"unknown_role":     "unknown role %q",
+		"admin_now":        "%d is now %s",
+		"admin_removed":    "%d is no longer an admin",
+		"cannot_ban_admin": "can not ban an admin",
+		"banned":           "banned %s",
+		"unbanned":         "unbanned %s",
+		"no_bans":          "no banned users",
+		"ban_forever":      "%s forever",
+		"ticket_ref":       "the contributor of ticket #%d",
+		"ban_until":        "%s until %s",
+
+		// dead letters and publish queue
+		"unknown_action":       "unknown action %q",
+		"dead_letters_cleared": "dead letters cleared",
+		"no_dead_letters":      "no dead letters",
+		"dead_letters_hint":    "/deadletters clear to delete them",
+		"dead_letter":          "%s %s to %s: %s",
+		"some_contributor":     "a contributor",
+		"queue_empty":          "publish queue is empty",
+		"queue_title":          "publish queue:",
+		"queue_line":           "%d. ticket #%d by %s, approved %s",
+		"queue_line_anonymous": "%d. ticket #%d, approved %s",
+		"queue_hint":           "reorder with /queue_move <ticket> <position>",
+		"not_queued":           "ticket #%d is not queued",
+	},
+	"zh": {
+		"unknown_command":    "未知命令 /%s，请查看 /help",
+		"usage":              "用法：%s",
+		"examples":           "示例：",
+		"more_help":          "发送 /help %s 查看示例",
+		"required_role":      "需要 %s 及以上权限",
+		"missing_arg":        "缺少 %s",
+		"not_a_number":       "%s %q 不是数字",
+		"unexpected_args":    "多余的参数 %q",
+		"too_many_commands":  "命令发送太频繁，请一分钟后再试。",
+		"cancelled":          "已取消",
+		"nothing_to_cancel":  "没有可以取消的操作",
+		"permission_denied":  "没有权限",
+		"button_unsupported": "这个按钮已经失效",
+
+		"need_settings":         "请先使用 /settings 修改设置",
+		"forward_failed":        "转发失败，请重试",
+		"too_fast":              "发送太快了，请一分钟后再试。",
+		"daily_limit":           "今天的投稿数量已达上限，谢谢！请明天再来。",
+		"flood_alert":           "%s (%d) 频繁触发限流，今天已丢弃 %d 条消息。\n发送 /ban %d 封禁该用户。",
+		"flood_alert_anonymous": "投稿 #%d 的投稿人频繁触发限流，今天已丢弃 %d 条消息。\n回复其投稿 /ban 可封禁该用户。",
+		"flood_alert_unknown":   "有投稿人频繁触发限流，今天已丢弃 %d 条消息。",
+		"notice_approved":       "你的投稿已通过审核，将很快发布。",
+		"notice_rejected":       "抱歉，你的投稿未被采用。",
+		"notice_changes":        "编辑希望你修改投稿，请发送修改后的版本。",
+		"notice_published":      "你的投稿已发布，谢谢！",
+		"source_not_found":      "找不到原消息",
+		"reply_failed":          "回复失败",
+		"reply_unreachable":     "回复失败，无法联系投稿人：%s",
+
+		"btn_approve":    "通过",
+		"btn_reject":     "拒绝",
+		"btn_changes":    "要求修改",
+		"ticket":         "投稿 #%d\n状态：%s",
+		"reviewed_by":    "处理人 %s",
+		"unreachable":    "投稿人自 %s 起无法联系：%s",
+		"already":        "已经是 %s",
+		"approve_failed": "审核通过失败：%s",
+
+		"status_unread":            "未读",
+		"status_forward":           "待审核",
+		"status_approved":          "已通过",
+		"status_rejected":          "已拒绝",
+		"status_changes_requested": "待修改",
+		"status_published":         "已发布",
+		"status_publish_failed":    "发布失败",
+
+		"settings":       "机器人介绍：%s\n欢迎语：%s\n感谢语：%s\n审核群：%d\n发布频道：%d\n发布时间：%s\n投稿限流：每分钟 %d 条，每天 %d 条\n匿名模式：%t\n审核群语言：%s",
+		"settings_texts": "[%s]\n机器人介绍：%s\n欢迎语：%s\n感谢语：%s",
+
+		"change_settings":           "修改设置\n%s",
+		"editing_texts":             "正在编辑 %s 语言的文字",
+		"unknown_language":          "%q 不是语言代码，例如 en 或 zh",
+		"update_success":            "更新成功\n%s",
+		"update_failed":             "更新失败",
+		"update_failed_error":       "更新失败\n 错误：%s",
+		"update_request_received":   "已收到修改请求",
+		"done":                      "完成",
+		"unknown_setting":           "未知设置",
+		"anonymous_state":           "匿名模式：%t",
+		"cancel_hint":               "发送 /cancel 保留当前值",
+		"btn_welcome_words":         "修改欢迎语",
+		"btn_bot_info":              "修改机器人介绍",
+		"btn_thanks":                "修改感谢语",
+		"btn_forward_to_chat_id":    "修改审核群 id",
+		"btn_publish_channel_id":    "修改发布频道 id",
+		"btn_publish_schedule":      "修改发布时间",
+		"btn_rate_limits":           "修改投稿限流",
+		"btn_review_language":       "修改审核群语言",
+		"btn_anonymous":             "切换匿名模式",
+		"btn_done":                  "完成",
+		"prompt_welcome_words":      "请发送新的欢迎语",
+		"prompt_bot_info":           "请发送新的机器人介绍",
+		"prompt_thanks":             "请发送新的感谢语",
+		"prompt_forward_to_chat_id": "请发送审核群的 id，在群里发送 /getchatid 可以查看",
+		"prompt_publish_channel_id": "请发送发布频道的 id",
+		"prompt_publish_schedule":   "请发送发布时间，间隔如 3h，或每天的时间如 09:00,18:00 Asia/Shanghai",
+		"prompt_rate_limits":        "请发送限流，每分钟和每天的投稿数，例如 5 50，0 表示不限",
+		"prompt_review_language":    "请发送审核群中投稿编号、审核按钮和提醒使用的语言代码，例如 en 或 zh",
+		"not_chat_id":               "%q 不是 chat id",
+		"not_text":                  "请以文字发送新的值",
+		"not_rate_limits":           "%q 不是两个数字，例如 5 50",
+
+		"unknown_role":     "未知权限 %q",
+		"admin_now":        "%d 现在是 %s",
+		"admin_removed":    "%d 已不再是管理员",
+		"cannot_ban_admin": "不能封禁管理员",
+		"banned":           "已封禁 %s",
+		"unbanned":         "已解封 %s",
+		"no_bans":          "没有被封禁的用户",
+		"ban_forever":      "%s 永久",
+		"ticket_ref":       "投稿 #%d 的投稿人",
+		"ban_until":        "%s 直到 %s",
+
+		"unknown_action":       "未知操作 %q",
+		"dead_letters_cleared": "已清空发送失败的消息",
+		"no_dead_letters":      "没有发送失败的消息",
+		"dead_letters_hint":    "发送 /deadletters clear 清空",
+		"dead_letter":          "%s %s 发往 %s：%s",
+		"some_contributor":     "一位投稿人",
+		"queue_empty":          "发布队列为空",
+		"queue_title":          "发布队列：",
+		"queue_line":           "%d. 投稿 #%d，来自 %s，通过于 %s",
+		"queue_line_anonymous": "%d. 投稿 #%d，通过于 %s",
+		"queue_hint":           "发送 /queue_move <投稿> <位置> 调整顺序",
+		"not_queued":           "投稿 #%d 不在队列中",
+
+		"cmd_start":       "开始使用机器人",
+		"cmd_help":        "查看命令，或某个命令的用法和示例",
+		"cmd_cancel":      "取消当前操作",
+		"cmd_settings":    "修改设置，或某种语言的文字",
+		"cmd_getchatid":   "查看当前聊天的 id",
+		"cmd_admins":      "查看管理员",
+		"cmd_addadmin":    "添加管理员或修改权限",
+		"cmd_deladmin":    "移除管理员",
+		"cmd_ban":         "封禁投稿人",
+		"cmd_unban":       "解除封禁",
+		"cmd_bans":        "查看被封禁的用户",
+		"cmd_deadletters": "查看发送失败的消息",
+		"cmd_queue":       "查看发布队列",
+		"cmd_queue_move":  "调整发布顺序",
+	},
+}
+
+// catalogError an error shown to users, the message is a catalog key translated for them
+type catalogError struct {
+	key  string
+	args []interface{}
+}
+
+func (e catalogError) Error() string {
+	return translate(defaultLanguage, e.key, e.args...)
+}
+
+// Text the message in the language of languageCode
+func (e catalogError) Text(languageCode string) string {
+	return translate(languageCode, e.key, e.args...)
+}
+
+// errorText err in the language of languageCode when it is a catalogError
+func errorText(languageCode string, err error) string {
+	var e catalogError
+	if errors.As(err, &e) {
+		return e.Text(languageCode)
+	}
+	return err.Error()
+}
+
+// validLanguage report whether lang looks like a language tag such as en or zh
+func validLanguage(lang string) bool {
+	if len(lang) < 2 || len(lang) > 3 {
+		return false
+	}
+	for _, r := range lang {
+		if r < 'a' || r > 'z' {
+			return false
+		}
+	}
+	return true
+}
+
+// languageTag the language part of a telegram language_code, "zh-hans" is "zh"
+func languageTag(languageCode string) string {
+	lang := strings.ToLower(languageCode)
+	if i := strings.IndexAny(lang, "-_"); i != -1 {
+		lang = lang[:i]
+	}
+	return lang
+}
+
+// language the catalog language for a telegram language_code
+func language(languageCode string) string {
+	lang := languageTag(languageCode)
+	if _, ok := catalog[lang]; ok {
+		return lang
+	}
+	return defaultLanguage
+}
+
+// lookup the message key in the user's language, falling back to english
+func lookup(languageCode, key string) (format string, ok bool) {
+	if format, ok = catalog[language(languageCode)][key]; !ok {
+		format, ok = catalog[defaultLanguage][key]
+	}
+	return
+}
+
+// translate format the message key in the user's language, falling back to english
+func translate(languageCode, key string, args ...interface{}) string {
+	format, _ := lookup(languageCode, key)
+	return fmt.Sprintf(format, args...)
+}
@@ -0,0 +1,135 @@
+package chatbots
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/doylecnn/contribution_bot/storage"
+	"github.com/gin-gonic/gin"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+const (
+	// inboxLease how long a worker owns a claimed update before it is replayed
+	inboxLease = 5 * time.Minute
+	// inboxPollInterval how often the inbox is checked for updates of other instances
+	// and updates whose lease expired
+	inboxPollInterval = 10 * time.Second
+)
+
+// errBadUpdate the received data is not a telegram update
+var errBadUpdate = errors.New("bad update")
+
+// receiveUpdate persist a raw update in the inbox and wake the dispatcher.
+// when it returns nil the update is safe to acknowledge to telegram
+func (c ChatBot) receiveUpdate(data []byte, notify chan<- struct{}) (err error) {
+	var update tgbotapi.Update
+	if err = json.Unmarshal(data, &update); err != nil {
+		return fmt.Errorf("%w: %v", errBadUpdate, err)
+	}
+	if update.UpdateID == 0 {
+		return fmt.Errorf("%w: no update_id", errBadUpdate)
+	}
+	err = c.storage.SaveInboxUpdate(context.Background(), storage.InboxUpdate{
+		UpdateID:   update.UpdateID,
+		ChatID:     updateChatID(update),
+		Data:       data,
+		ReceivedAt: time.Now(),
+	})
+	if err != nil {
+		return
+	}
+	select {
+	case notify <- struct{}{}:
+	default:
+	}
+	return
+}
+
+// webhookHandler answer telegram only after the update is committed to the inbox,
+// so telegram redelivers updates we failed to store. malformed updates are logged
+// and acknowledged, redelivering them would not make them readable
+func (c ChatBot) webhookHandler(notify chan<- struct{}) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		data, err := ioutil.ReadAll(ctx.Request.Body)
+		if err != nil {
+			ctx.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		if err = c.receiveUpdate(data, notify); err != nil {
+			if errors.Is(err, errBadUpdate) {
+				c.logger.Warn().Err(err).Bytes("body", data).Msg("drop bad update")
+				ctx.Status(http.StatusOK)
+				return
+			}
+			c.logger.Error().Err(err).Msg("save update failed")
+			ctx.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		ctx.Status(http.StatusOK)
+	}
+}
+
+// dispatchInbox claim updates from the inbox and hand them to the workers,
+// whenever notified and every inboxPollInterval
+func (c ChatBot) dispatchInbox(shards updateShards, notify <-chan struct{}) {
+	ticker := time.NewTicker(inboxPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-notify:
+		case <-ticker.C:
+		}
+		for c.dispatchOnce(shards) {
+		}
+	}
+}
+
+// dispatchOnce claim only as many updates of each shard as it has room for, so a busy
+// chat leaves its updates in the inbox instead of holding up the other shards.
+// returns true when there may be more to claim
+func (c ChatBot) dispatchOnce(shards updateShards) bool {
+	free := shards.free()
+	total := 0
+	for _, n := range free {
+		total += n
+	}
+	if total == 0 {
+		return false
+	}
+	// storage may scan more than once, each scan counts the room from the start
+	claimed, err := c.storage.ClaimInboxUpdates(context.Background(), time.Now(), inboxLease, total, func() storage.InboxFilter {
+		room := append([]int(nil), free...)
+		return func(chatID int64) bool {
+			i := shards.index(chatID)
+			if room[i] == 0 {
+				return false
+			}
+			room[i]--
+			return true
+		}
+	})
+	if err != nil {
+		c.logger.Error().Err(err).Msg("claim updates failed")
+		return false
+	}
+	for _, item := range claimed {
+		var update tgbotapi.Update
+		if err = json.Unmarshal(item.Data, &update); err != nil {
+			c.logger.Error().Err(err).Int("updateID", item.UpdateID).Msg("drop bad update")
+			c.storage.AckInboxUpdate(context.Background(), item.UpdateID)
+			continue
+		}
+		if !shards.trySend(inboxItem{update: update, claimedUntil: item.ClaimedUntil}) {
+			// the room was counted above and only the dispatcher sends, so this
+			// is not expected; the update comes back once its lease expires
+			c.logger.Warn().Int("updateID", item.UpdateID).Msg("shard full, update left to its lease")
+		}
+	}
+	return len(claimed) == total
+}
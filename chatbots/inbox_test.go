@@ -0,0 +1,75 @@
+package chatbots
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/doylecnn/contribution_bot/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// failingInboxStorage can not store updates
+type failingInboxStorage struct {
+	storage.Storage
+}
+
+func (s failingInboxStorage) SaveInboxUpdate(ctx context.Context, update storage.InboxUpdate) error {
+	return errors.New("unavailable")
+}
+
+func TestWebhookHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	const update = `{"update_id": 7, "message": {"message_id": 1, "chat": {"id": 42, "type": "private"}, "text": "hi"}}`
+	tests := []struct {
+		name    string
+		failing bool
+		body    string
+		status  int
+		// stored the update_id expected in the inbox, 0 for none
+		stored int
+	}{
+		{name: "update", body: update, status: http.StatusOK, stored: 7},
+		{name: "not json", body: "{", status: http.StatusOK},
+		{name: "no update_id", body: `{"message": {"message_id": 1}}`, status: http.StatusOK},
+		// telegram redelivers updates we could not store
+		{name: "storage failed", failing: true, body: update, status: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := storage.Storage(storage.NewMemoryStorage())
+			if tt.failing {
+				s = failingInboxStorage{s}
+			}
+			_, _, c := newTestChatBotWith(t, s, storage.Settings{})
+			notify := make(chan struct{}, 1)
+			r := gin.New()
+			r.POST("/webhook", c.webhookHandler(notify))
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(tt.body)))
+			if w.Code != tt.status {
+				t.Errorf("status %d, want %d", w.Code, tt.status)
+			}
+			claimed, err := s.ClaimInboxUpdates(context.Background(), time.Now(), time.Minute, 10, func() storage.InboxFilter {
+				return func(chatID int64) bool { return true }
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			switch {
+			case tt.stored == 0 && len(claimed) != 0:
+				t.Errorf("inbox has %+v, want nothing", claimed)
+			case tt.stored != 0 && (len(claimed) != 1 || claimed[0].UpdateID != tt.stored || claimed[0].ChatID != 42):
+				t.Errorf("inbox has %+v, want update %d of chat 42", claimed, tt.stored)
+			}
+			if notified := len(notify) == 1; notified != (tt.stored != 0) {
+				t.Errorf("dispatcher notified %v, want %v", notified, tt.stored != 0)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package chatbots
+
+import (
+	"context"
+
+	"github.com/doylecnn/contribution_bot/storage"
+)
+
+// commandMenu the commands telegram offers to the users of scope, nil scope is everyone
+type commandMenu struct {
+	scope    *BotCommandScope
+	commands []Command
+}
+
+// chatScope menu of one chat, for a private chat the chat id is the user id
+func chatScope(chatID int64) *BotCommandScope {
+	return &BotCommandScope{Type: "chat", ChatID: chatID}
+}
+
+// menuLanguages language codes menus are set for, "" is the default in english
+func menuLanguages() []string {
+	languages := []string{""}
+	for lang := range catalog {
+		if lang != defaultLanguage {
+			languages = append(languages, lang)
+		}
+	}
+	return languages
+}
+
+// roleCommands commands a user with role may run, role is empty for contributors
+func (r router) roleCommands(role string) (cmds []Command) {
+	for _, cmd := range r.commandList() {
+		if roleRank[cmd.Role] <= roleRank[role] {
+			cmds = append(cmds, cmd)
+		}
+	}
+	return
+}
+
+// reviewGroupCommands commands offered in the review group
+func (r router) reviewGroupCommands() (cmds []Command) {
+	for _, cmd := range r.commandList() {
+		if cmd.ReviewGroup {
+			cmds = append(cmds, cmd)
+		}
+	}
+	return
+}
+
+// commandMenus contributor commands for everyone, the admin set in each admin's
+// private chat and review commands in the review group
+func (c ChatBot) commandMenus() (menus []commandMenu, err error) {
+	menus = append(menus, commandMenu{commands: c.router.roleCommands("")})
+	admins, err := c.storage.GetAdmins(context.Background())
+	if err != nil {
+		return
+	}
+	menus = append(menus, commandMenu{scope: chatScope(int64(c.adminID)), commands: c.router.roleCommands(storage.RoleOwner)})
+	for _, admin := range admins {
+		if admin.UserID != c.adminID {
+			menus = append(menus, commandMenu{scope: chatScope(int64(admin.UserID)), commands: c.router.roleCommands(admin.Role)})
+		}
+	}
+	if settings, err := c.settings.Get(context.Background()); err == nil && settings.ForwardMessageToChatID != 0 {
+		menus = append(menus, commandMenu{scope: chatScope(settings.ForwardMessageToChatID), commands: c.router.reviewGroupCommands()})
+	}
+	return
+}
+
+// syncCommands update every menu telegram shows differently, in every catalog language
+func (c ChatBot) syncCommands() {
+	menus, err := c.commandMenus()
+	if err != nil {
+		c.logger.Error().Err(err).Msg("list command menus failed")
+	}
+	for _, menu := range menus {
+		c.syncMenu(menu)
+	}
+}
+
+// syncMenu set the menu unless telegram already has it
+func (c ChatBot) syncMenu(menu commandMenu) {
+	for _, languageCode := range menuLanguages() {
+		commands := botCommands(menu.commands, languageCode)
+		current, err := c.getMyCommands(menu.scope, languageCode)
+		if err == nil && equalCommands(current, commands) {
+			continue
+		}
+		if _, err = c.setMyCommands(commands, menu.scope, languageCode); err != nil {
+			c.logger.Error().Err(err).Interface("scope", menu.scope).Str("languageCode", languageCode).
+				Msg("set commands failed")
+		}
+	}
+}
+
+// deleteMenu fall back to the menus of wider scopes for the chat
+func (c ChatBot) deleteMenu(chatID int64) {
+	for _, languageCode := range menuLanguages() {
+		if _, err := c.deleteMyCommands(chatScope(chatID), languageCode); err != nil {
+			c.logger.Error().Err(err).Int64("chatID", chatID).Str("languageCode", languageCode).
+				Msg("delete commands failed")
+		}
+	}
+}
+
+// syncAdminMenu show the commands of role in the admin's private chat, or the
+// contributor commands when role is empty
+func (c ChatBot) syncAdminMenu(userID int, role string) {
+	if len(role) == 0 {
+		c.deleteMenu(int64(userID))
+		return
+	}
+	c.syncMenu(commandMenu{scope: chatScope(int64(userID)), commands: c.router.roleCommands(role)})
+}
+
+// moveReviewGroupMenu move the review commands when the review group changes
+func (c ChatBot) moveReviewGroupMenu(from, to int64) {
+	if from != 0 {
+		c.deleteMenu(from)
+	}
+	if to != 0 {
+		c.syncMenu(commandMenu{scope: chatScope(to), commands: c.router.reviewGroupCommands()})
+	}
+}
+
+func equalCommands(a, b []BotCommand) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,85 @@
+package chatbots
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// commandsPerMinute most commands a user may send per minute
+const commandsPerMinute = 20
+
+// Middleware wrap a command handler, e.g. to check permissions before it runs
+type Middleware func(next CommandHandler) CommandHandler
+
+// chain wrap handler in middlewares, the first one runs first
+func chain(handler CommandHandler, middlewares ...Middleware) CommandHandler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// requireRole ignore the command unless the user is an admin with role
+func requireRole(role string) Middleware {
+	return func(next CommandHandler) CommandHandler {
+		return func(c ChatBot, message *tgbotapi.Message) (err error) {
+			if !c.hasRole(message.From.ID, role) {
+				c.logger.Debug().Int("userID", message.From.ID).Str("command", message.Command()).
+					Str("role", role).Msg("command denied")
+				return
+			}
+			return next(c, message)
+		}
+	}
+}
+
+// recoverCommand turn a panic in the handler into an error
+func recoverCommand(next CommandHandler) CommandHandler {
+	return func(c ChatBot, message *tgbotapi.Message) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("panic: %v\n%s", r, debug.Stack())
+			}
+		}()
+		return next(c, message)
+	}
+}
+
+// logCommand log who ran the command and how long it took
+func logCommand(next CommandHandler) CommandHandler {
+	return func(c ChatBot, message *tgbotapi.Message) (err error) {
+		start := time.Now()
+		err = next(c, message)
+		c.logger.Info().Str("command", message.Command()).
+			Int("userID", message.From.ID).
+			Int64("chatID", message.Chat.ID).
+			Dur("elapsed", time.Since(start)).
+			AnErr("error", err).
+			Msg("command")
+		return
+	}
+}
+
+// limitCommands drop commands of users sending more than commandsPerMinute,
+// telling them once per minute. storage errors let the command through
+func limitCommands(next CommandHandler) CommandHandler {
+	return func(c ChatBot, message *tgbotapi.Message) (err error) {
+		minute := time.Now().UTC().Truncate(time.Minute)
+		key := fmt.Sprintf("cmd:%d:minute:%d", message.From.ID, minute.Unix())
+		count, e := c.storage.IncrCounter(context.Background(), key, minute.Add(time.Minute))
+		if e != nil {
+			c.logger.Error().Err(e).Send()
+		} else if count > commandsPerMinute {
+			if count == commandsPerMinute+1 {
+				_, err = c.botClient.Send(tgbotapi.NewMessage(message.Chat.ID,
+					translate(message.From.LanguageCode, "too_many_commands")))
+			}
+			return
+		}
+		return next(c, message)
+	}
+}
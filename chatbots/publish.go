@@ -0,0 +1,230 @@
+package chatbots
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/doylecnn/contribution_bot/storage"
+	"github.com/gin-gonic/gin"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+const (
+	// defaultPublishInterval used when no publish schedule is set
+	defaultPublishInterval = time.Hour
+	// publishLease how long a claimed item is left alone before it is tried again,
+	// in case the instance publishing it died
+	publishLease = 5 * time.Minute
+	// maxPublishAttempts failed copies after which an item is dropped from the queue
+	maxPublishAttempts = 3
+)
+
+// publishSchedule either publishes every interval, or at daily slots
+type publishSchedule struct {
+	interval time.Duration
+	// slots minutes after midnight in location, sorted
+	slots    []int
+	location *time.Location
+}
+
+// parseSchedule parse settings.PublishSchedule
+func parseSchedule(s string) (schedule publishSchedule, err error) {
+	s = strings.TrimSpace(s)
+	if len(s) == 0 {
+		return publishSchedule{interval: defaultPublishInterval}, nil
+	}
+	if !strings.Contains(s, ":") {
+		schedule.interval, err = time.ParseDuration(s)
+		if err == nil && schedule.interval < time.Minute {
+			err = errors.New("publish interval must be at least 1m")
+		}
+		return
+	}
+	schedule.location = time.UTC
+	fields := strings.Fields(s)
+	if len(fields) > 2 {
+		return schedule, fmt.Errorf("bad publish schedule: %s", s)
+	}
+	if len(fields) == 2 {
+		if schedule.location, err = time.LoadLocation(fields[1]); err != nil {
+			return
+		}
+	}
+	for _, slot := range strings.Split(fields[0], ",") {
+		var t time.Time
+		if t, err = time.Parse("15:04", strings.TrimSpace(slot)); err != nil {
+			return
+		}
+		schedule.slots = append(schedule.slots, t.Hour()*60+t.Minute())
+	}
+	sort.Ints(schedule.slots)
+	return
+}
+
+// slotStart start of the publishing slot now falls in,
+// one item is published per slot
+func (p publishSchedule) slotStart(now time.Time) time.Time {
+	if len(p.slots) == 0 {
+		return now.Truncate(p.interval)
+	}
+	local := now.In(p.location)
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, p.location)
+	for i := len(p.slots) - 1; i >= 0; i-- {
+		start := midnight.Add(time.Duration(p.slots[i]) * time.Minute)
+		if !start.After(local) {
+			return start
+		}
+	}
+	// before the first slot of today, still in the last slot of yesterday
+	return midnight.AddDate(0, 0, -1).Add(time.Duration(p.slots[len(p.slots)-1]) * time.Minute)
+}
+
+// publishNext cron job, publish the head of the queue when its slot is due.
+// running it twice in one slot publishes only once
+func (c ChatBot) publishNext(ctx *gin.Context) {
+	if err := c.publishDue(time.Now()); err != nil {
+		c.logger.Error().Err(err).Send()
+		ctx.JSON(200, "failed")
+		ctx.Abort()
+		return
+	}
+	ctx.JSON(200, "OK")
+}
+
+func (c ChatBot) publishDue(now time.Time) (err error) {
+	settings, err := c.settings.Get(context.Background())
+	if err != nil {
+		return
+	}
+	if settings.PublishChannelID == 0 {
+		return
+	}
+	schedule, err := parseSchedule(settings.PublishSchedule)
+	if err != nil {
+		return
+	}
+	item, ok, err := c.storage.ClaimNextPublish(context.Background(), schedule.slotStart(now), now, publishLease)
+	if err != nil || !ok {
+		return
+	}
+	_, err = c.copyMessage(CopyMessageConfig{
+		ChatID:     settings.PublishChannelID,
+		FromChatID: item.ChatID,
+		MessageID:  item.MessageID,
+	})
+	if err != nil {
+		if item.Attempts >= maxPublishAttempts {
+			c.dropPublish(item, err)
+			return
+		}
+		// keep its place in the queue, it goes out in the next slot
+		item.ClaimedUntil = time.Time{}
+		if e := c.storage.EnqueuePublish(context.Background(), item); e != nil {
+			c.logger.Error().Err(e).Str("id", item.ID).Msg("release publish claim failed")
+		}
+		return
+	}
+	if err = c.storage.DequeuePublish(context.Background(), item.ID); err != nil {
+		c.logger.Error().Err(err).Str("id", item.ID).Send()
+	}
+	err = c.storage.UpdateMessageStatus(context.Background(), storage.Message{
+		ID:        item.ID,
+		ForwardID: item.ForwardID,
+		Status:    storage.StatusPublished,
+	})
+	if err != nil {
+		c.logger.Error().Err(err).Send()
+	}
+	_, err = c.botClient.Send(tgbotapi.MessageConfig{
+		BaseChat: tgbotapi.BaseChat{
+			ChatID:           item.ChatID,
+			ReplyToMessageID: item.MessageID,
+		},
+		Text: translate(item.LanguageCode, "notice_published"),
+	})
+	return
+}
+
+// dropPublish give up on an item that could not be copied maxPublishAttempts times,
+// e.g. because the contributor deleted the message, so it stops using up the slots
+func (c ChatBot) dropPublish(item storage.QueueItem, err error) {
+	c.logger.Error().Err(err).Str("id", item.ID).Int("attempts", item.Attempts).Msg("give up publishing")
+	payload, _ := json.Marshal(item)
+	e := c.storage.SaveDeadLetter(context.Background(), storage.DeadLetter{
+		Method:   "publish",
+		ChatID:   item.ChatID,
+		Payload:  string(payload),
+		Error:    err.Error(),
+		FailedAt: time.Now(),
+	})
+	if e != nil {
+		c.logger.Error().Err(e).Msg("save dead letter failed")
+	}
+	if e = c.storage.DequeuePublish(context.Background(), item.ID); e != nil {
+		c.logger.Error().Err(e).Str("id", item.ID).Send()
+	}
+	e = c.storage.UpdateMessageStatus(context.Background(), storage.Message{
+		ID:        item.ID,
+		ForwardID: item.ForwardID,
+		Status:    storage.StatusPublishFailed,
+	})
+	if e != nil {
+		c.logger.Error().Err(e).Send()
+	}
+}
+
+func cmdQueue(c ChatBot, message *tgbotapi.Message) (err error) {
+	items, err := c.storage.ListPublishQueue(context.Background())
+	if err != nil {
+		return
+	}
+	languageCode := message.From.LanguageCode
+	var text string
+	if len(items) == 0 {
+		text = translate(languageCode, "queue_empty")
+	} else {
+		// in anonymous mode contributors are not named, the ticket is enough to review
+		anonymous := c.anonymous()
+		lines := make([]string, len(items))
+		for i, item := range items {
+			approvedAt := item.EnqueuedAt.UTC().Format("01-02 15:04")
+			if anonymous {
+				lines[i] = translate(languageCode, "queue_line_anonymous", i+1, item.ForwardID, approvedAt)
+			} else {
+				lines[i] = translate(languageCode, "queue_line", i+1, item.ForwardID, item.Username, approvedAt)
+			}
+		}
+		text = translate(languageCode, "queue_title") + "\n" + strings.Join(lines, "\n") +
+			"\n\n" + translate(languageCode, "queue_hint")
+	}
+	_, err = c.botClient.Send(tgbotapi.NewMessage(message.Chat.ID, text))
+	return
+}
+
+func cmdQueueMove(c ChatBot, message *tgbotapi.Message) (err error) {
+	args := newCommandArgs(message)
+	ticket := args.Int("ticket")
+	position := args.Int("position")
+	if err = args.Err(); err != nil {
+		return
+	}
+	items, err := c.storage.ListPublishQueue(context.Background())
+	if err != nil {
+		return
+	}
+	for _, item := range items {
+		if item.ForwardID == ticket {
+			if err = c.storage.MovePublishQueueItem(context.Background(), item.ID, position-1); err != nil {
+				return
+			}
+			return cmdQueue(c, message)
+		}
+	}
+	_, err = c.botClient.Send(tgbotapi.NewMessage(message.Chat.ID, translate(message.From.LanguageCode, "not_queued", ticket)))
+	return
+}
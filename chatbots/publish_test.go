@@ -0,0 +1,168 @@
+package chatbots
+
+import (
+	"context"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/doylecnn/contribution_bot/storage"
+	"github.com/doylecnn/contribution_bot/telegramtest"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+const testChannelID = -1002
+
+func TestParseSchedule(t *testing.T) {
+	tests := []struct {
+		schedule string
+		interval time.Duration
+		slots    []int
+		location string
+		err      bool
+	}{
+		{schedule: "", interval: defaultPublishInterval},
+		{schedule: "3h", interval: 3 * time.Hour},
+		{schedule: "30s", err: true},
+		{schedule: "09:00,18:00", slots: []int{540, 1080}, location: "UTC"},
+		{schedule: "18:00, 09:00 Asia/Shanghai", err: true},
+		{schedule: "18:00,09:00 Asia/Shanghai", slots: []int{540, 1080}, location: "Asia/Shanghai"},
+		{schedule: "9am", err: true},
+		{schedule: "09:00 Nowhere/City", err: true},
+		{schedule: "09:00 UTC extra", err: true},
+	}
+	for _, tt := range tests {
+		schedule, err := parseSchedule(tt.schedule)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%q: want an error, got %+v", tt.schedule, schedule)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tt.schedule, err)
+			continue
+		}
+		if schedule.interval != tt.interval || !reflect.DeepEqual(schedule.slots, tt.slots) {
+			t.Errorf("%q: interval %v slots %v, want %v %v", tt.schedule, schedule.interval, schedule.slots, tt.interval, tt.slots)
+		}
+		if len(tt.location) != 0 && schedule.location.String() != tt.location {
+			t.Errorf("%q: location %v, want %s", tt.schedule, schedule.location, tt.location)
+		}
+	}
+}
+
+func TestSlotStart(t *testing.T) {
+	utc := func(day, hour, min int) time.Time {
+		return time.Date(2026, 10, day, hour, min, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		schedule string
+		now      time.Time
+		start    time.Time
+	}{
+		{"", utc(17, 10, 20), utc(17, 10, 0)},
+		{"3h", utc(17, 10, 20), utc(17, 9, 0)},
+		{"3h", utc(17, 9, 0), utc(17, 9, 0)},
+		{"09:00,18:00", utc(17, 10, 0), utc(17, 9, 0)},
+		{"09:00,18:00", utc(17, 18, 0), utc(17, 18, 0)},
+		{"09:00,18:00", utc(17, 23, 59), utc(17, 18, 0)},
+		// before the first slot of the day
+		{"09:00,18:00", utc(17, 8, 59), utc(16, 18, 0)},
+		// 09:00 in Shanghai is 01:00 utc
+		{"09:00 Asia/Shanghai", utc(17, 1, 0), utc(17, 1, 0)},
+		{"09:00 Asia/Shanghai", utc(17, 0, 30), utc(16, 1, 0)},
+		{"09:00 Asia/Shanghai", utc(16, 23, 0), utc(16, 1, 0)},
+	}
+	for _, tt := range tests {
+		schedule, err := parseSchedule(tt.schedule)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.schedule, err)
+		}
+		if start := schedule.slotStart(tt.now); !start.Equal(tt.start) {
+			t.Errorf("%q at %v: slot starts %v, want %v", tt.schedule, tt.now, start.UTC(), tt.start)
+		}
+	}
+}
+
+// newPublishTest a bot publishing hourly to testChannelID with one approved message queued
+func newPublishTest(t *testing.T) (*telegramtest.Server, storage.Storage, ChatBot, string) {
+	server, s, c := newTestChatBot(t, storage.Settings{ForwardMessageToChatID: testReviewGroupID, PublishChannelID: testChannelID})
+	ctx := context.Background()
+	msg := storage.Message{UserID: testContributorID, ChatID: testContributorID, MessageID: 10, ForwardID: 100,
+		Time: time.Now(), Status: storage.StatusApproved}
+	id, err := s.CreateNewMessage(ctx, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.EnqueuePublish(ctx, storage.QueueItem{ID: id, ChatID: msg.ChatID, MessageID: msg.MessageID,
+		ForwardID: msg.ForwardID, EnqueuedAt: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server, s, c, id
+}
+
+func TestPublishDueTwiceInSlot(t *testing.T) {
+	server, s, c, _ := newPublishTest(t)
+	now := time.Date(2026, 10, 17, 10, 20, 0, 0, time.UTC)
+	for _, at := range []time.Time{now, now.Add(time.Minute)} {
+		if err := c.publishDue(at); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if sent := server.Sent(testChannelID); len(sent) != 1 {
+		t.Errorf("channel got %d messages, want one", len(sent))
+	}
+	msg, err := s.GetMessage(context.Background(), 100)
+	if err != nil || msg.Status != storage.StatusPublished {
+		t.Errorf("message = %+v, %v, want published", msg, err)
+	}
+	if items, _ := s.ListPublishQueue(context.Background()); len(items) != 0 {
+		t.Errorf("queue = %+v, want empty", items)
+	}
+}
+
+func TestPublishDueDropsAfterMaxAttempts(t *testing.T) {
+	server, s, c, _ := newPublishTest(t)
+	server.Handle("copyMessage", func(params url.Values) tgbotapi.APIResponse {
+		return telegramtest.Error(400, "Bad Request: message to copy not found", nil)
+	})
+	ctx := context.Background()
+	slot := time.Date(2026, 10, 17, 10, 0, 0, 0, time.UTC)
+	for attempt := 1; attempt <= maxPublishAttempts; attempt++ {
+		if err := c.publishDue(slot); err == nil {
+			t.Fatalf("attempt %d: publish of a missing message succeeded", attempt)
+		}
+		items, err := s.ListPublishQueue(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if queued := len(items) == 1; queued != (attempt < maxPublishAttempts) {
+			t.Fatalf("attempt %d: queue = %+v", attempt, items)
+		}
+		slot = slot.Add(defaultPublishInterval)
+	}
+
+	msg, err := s.GetMessage(ctx, 100)
+	if err != nil || msg.Status != storage.StatusPublishFailed {
+		t.Errorf("message = %+v, %v, want publish failed", msg, err)
+	}
+	letters, err := s.ListDeadLetters(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dropped int
+	for _, letter := range letters {
+		if letter.Method == "publish" {
+			dropped++
+		}
+	}
+	if dropped != 1 {
+		t.Errorf("dead letters %+v, want one for the dropped item", letters)
+	}
+	if sent := server.Sent(testContributorID); len(sent) != 0 {
+		t.Errorf("contributor got %v, want no published notice", sent)
+	}
+}
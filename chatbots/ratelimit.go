@@ -0,0 +1,112 @@
+package chatbots
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/doylecnn/contribution_bot/storage"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// floodAlertThreshold throttled messages per day after which admins are alerted
+const floodAlertThreshold = 10
+
+// allowSubmission count the submission against the per user limits in settings.
+// throttled users are told once per window, and admins are alerted about users
+// who keep hitting the limit. storage errors let the message through
+func (c ChatBot) allowSubmission(message *tgbotapi.Message, settings storage.Settings) bool {
+	if settings.RateLimitPerMinute <= 0 && settings.RateLimitPerDay <= 0 {
+		return true
+	}
+	now := time.Now().UTC()
+	userID := message.From.ID
+	minute := now.Truncate(time.Minute)
+	day := now.Truncate(24 * time.Hour)
+
+	var throttleText string
+	if settings.RateLimitPerMinute > 0 {
+		key := fmt.Sprintf("rate:%d:minute:%d", userID, minute.Unix())
+		count, err := c.storage.IncrCounter(context.Background(), key, minute.Add(time.Minute))
+		if err != nil {
+			c.logger.Error().Err(err).Send()
+			return true
+		}
+		if count > settings.RateLimitPerMinute {
+			if count == settings.RateLimitPerMinute+1 {
+				throttleText = translate(message.From.LanguageCode, "too_fast")
+			}
+			c.recordThrottled(message, day, throttleText)
+			return false
+		}
+	}
+	if settings.RateLimitPerDay > 0 {
+		key := fmt.Sprintf("rate:%d:day:%d", userID, day.Unix())
+		count, err := c.storage.IncrCounter(context.Background(), key, day.Add(24*time.Hour))
+		if err != nil {
+			c.logger.Error().Err(err).Send()
+			return true
+		}
+		if count > settings.RateLimitPerDay {
+			if count == settings.RateLimitPerDay+1 {
+				throttleText = translate(message.From.LanguageCode, "daily_limit")
+			}
+			c.recordThrottled(message, day, throttleText)
+			return false
+		}
+	}
+	return true
+}
+
+// recordThrottled reply throttleText when not empty, and alert the review group
+// when the user was throttled floodAlertThreshold times today
+func (c ChatBot) recordThrottled(message *tgbotapi.Message, day time.Time, throttleText string) {
+	if len(throttleText) != 0 {
+		_, err := c.botClient.Send(tgbotapi.MessageConfig{
+			BaseChat: tgbotapi.BaseChat{
+				ChatID:           message.Chat.ID,
+				ReplyToMessageID: message.MessageID,
+			},
+			Text: throttleText,
+		})
+		if err != nil {
+			c.logger.Error().Err(err).Send()
+		}
+	}
+	key := fmt.Sprintf("throttled:%d:day:%d", message.From.ID, day.Unix())
+	count, err := c.storage.IncrCounter(context.Background(), key, day.Add(24*time.Hour))
+	if err != nil {
+		c.logger.Error().Err(err).Send()
+		return
+	}
+	if count != floodAlertThreshold {
+		return
+	}
+	settings, err := c.settings.Get(context.Background())
+	if err != nil || settings.ForwardMessageToChatID == 0 {
+		return
+	}
+	c.logger.Warn().Int("userID", message.From.ID).Int("throttled", count).Msg("user keeps hitting rate limit")
+	_, err = c.botClient.Send(tgbotapi.NewMessage(settings.ForwardMessageToChatID,
+		c.floodAlert(message.From, count, settings)))
+	if err != nil {
+		c.logger.Error().Err(err).Send()
+	}
+}
+
+// floodAlert the alert about user for the review group, in its language. in anonymous
+// mode the user is only referred to by the ticket of their latest submission
+func (c ChatBot) floodAlert(user *tgbotapi.User, count int, settings storage.Settings) string {
+	languageCode := settings.ReviewLanguage
+	if !settings.Anonymous {
+		return translate(languageCode, "flood_alert", displayName(user), user.ID, count, user.ID)
+	}
+	latest, err := c.storage.GetLatestMessage(context.Background(), user.ID)
+	if err != nil {
+		if err != storage.ErrMessageNotFound {
+			c.logger.Error().Err(err).Int("userID", user.ID).Send()
+		}
+		return translate(languageCode, "flood_alert_unknown", count)
+	}
+	return translate(languageCode, "flood_alert_anonymous", latest.ForwardID, count)
+}
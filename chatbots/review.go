@@ -0,0 +1,175 @@
+package chatbots
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/doylecnn/contribution_bot/storage"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// reviewCallbackPrefix callback data of review buttons, followed by action and forwardID
+const reviewCallbackPrefix = "/review_"
+
+// review actions
+const (
+	reviewApprove = "approve"
+	reviewReject  = "reject"
+	reviewChanges = "changes"
+)
+
+// reviewLanguage language of tickets, review buttons and alerts in the shared review group
+func (c ChatBot) reviewLanguage() string {
+	settings, err := c.settings.Get(context.Background())
+	if err != nil || len(settings.ReviewLanguage) == 0 {
+		return defaultLanguage
+	}
+	return settings.ReviewLanguage
+}
+
+// reviewMarkup review buttons in the review group's language
+func reviewMarkup(languageCode string, forwardID int) tgbotapi.InlineKeyboardMarkup {
+	data := func(action string) string {
+		return callbackData(reviewCallbackPrefix, action, forwardID)
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(translate(languageCode, "btn_approve"), data(reviewApprove)),
+		tgbotapi.NewInlineKeyboardButtonData(translate(languageCode, "btn_reject"), data(reviewReject)),
+		tgbotapi.NewInlineKeyboardButtonData(translate(languageCode, "btn_changes"), data(reviewChanges)),
+	))
+}
+
+func ticketText(languageCode string, forwardID int, status string) string {
+	return translate(languageCode, "ticket", forwardID, statusText(languageCode, status))
+}
+
+// statusText message status in the language of languageCode, status_<status> in the catalog
+func statusText(languageCode, status string) string {
+	if text, ok := lookup(languageCode, "status_"+status); ok {
+		return text
+	}
+	return status
+}
+
+// reviewable a reviewer may still act on messages in these status
+func reviewable(status string) bool {
+	return status == storage.StatusForward || status == storage.StatusChangesRequested
+}
+
+// cbReview review button pressed, args are action and forwardID
+func cbReview(c ChatBot, query *tgbotapi.CallbackQuery, args []string) (err error) {
+	if len(args) != 2 {
+		return fmt.Errorf("bad review callback %q", query.Data)
+	}
+	forwardID, err := strconv.Atoi(args[1])
+	if err != nil {
+		return
+	}
+	c.handleReviewCallback(query, args[0], forwardID)
+	return
+}
+
+func (c ChatBot) handleReviewCallback(query *tgbotapi.CallbackQuery, action string, forwardID int) {
+	languageCode := query.From.LanguageCode
+	originmsg, err := c.storage.GetMessage(context.Background(), forwardID)
+	if err != nil {
+		c.logger.Error().Err(err).Send()
+		c.botClient.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, translate(languageCode, "source_not_found")))
+		return
+	}
+	if !reviewable(originmsg.Status) {
+		c.botClient.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID,
+			translate(languageCode, "already", statusText(languageCode, originmsg.Status))))
+		return
+	}
+
+	// the notice goes to the contributor, in their language
+	var notice string
+	switch action {
+	case reviewApprove:
+		if err = c.approve(&originmsg); err != nil {
+			c.logger.Error().Err(err).Int("forwardID", forwardID).Msg("approve failed")
+			c.botClient.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, translate(languageCode, "approve_failed", err.Error())))
+			return
+		}
+		notice = "notice_approved"
+	case reviewReject:
+		originmsg.Status = storage.StatusRejected
+		notice = "notice_rejected"
+	case reviewChanges:
+		originmsg.Status = storage.StatusChangesRequested
+		notice = "notice_changes"
+	default:
+		return
+	}
+	if action != reviewApprove {
+		if err = c.storage.UpdateMessageStatus(context.Background(), originmsg); err != nil {
+			c.logger.Error().Err(err).Send()
+			c.botClient.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, translate(languageCode, "update_failed")))
+			return
+		}
+	}
+
+	_, err = c.botClient.Send(tgbotapi.MessageConfig{
+		BaseChat: tgbotapi.BaseChat{
+			ChatID:           originmsg.ChatID,
+			ReplyToMessageID: originmsg.MessageID,
+		},
+		Text: translate(originmsg.LanguageCode, notice),
+	})
+	if isBlockedError(err) {
+		c.markUnreachable(originmsg.UserID, err)
+	} else if err != nil {
+		c.logger.Error().Err(err).Send()
+	}
+
+	reviewLanguage := c.reviewLanguage()
+	edit := tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID,
+		ticketText(reviewLanguage, forwardID, originmsg.Status)+"\n"+translate(reviewLanguage, "reviewed_by", displayName(query.From))+
+			c.unreachableNote(reviewLanguage, originmsg.UserID))
+	if reviewable(originmsg.Status) {
+		markup := reviewMarkup(reviewLanguage, forwardID)
+		edit.ReplyMarkup = &markup
+	}
+	c.botClient.Send(edit)
+	c.botClient.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, statusText(languageCode, originmsg.Status)))
+}
+
+// approve mark the message approved and put it in the publish queue
+func (c ChatBot) approve(originmsg *storage.Message) (err error) {
+	settings, err := c.settings.Get(context.Background())
+	if err != nil {
+		return
+	}
+	if settings.PublishChannelID == 0 {
+		return errors.New("publish channel not set")
+	}
+	err = c.storage.EnqueuePublish(context.Background(), storage.QueueItem{
+		ID:           originmsg.ID,
+		Username:     originmsg.Username,
+		ChatID:       originmsg.ChatID,
+		MessageID:    originmsg.MessageID,
+		ForwardID:    originmsg.ForwardID,
+		EnqueuedAt:   time.Now(),
+		LanguageCode: originmsg.LanguageCode,
+	})
+	if err != nil {
+		return
+	}
+	originmsg.Status = storage.StatusApproved
+	return c.storage.UpdateMessageStatus(context.Background(), *originmsg)
+}
+
+// displayName username, or first name, or id of user
+func displayName(user *tgbotapi.User) string {
+	if len(user.UserName) != 0 {
+		return user.UserName
+	}
+	if len(user.FirstName) != 0 {
+		return user.FirstName
+	}
+	return fmt.Sprintf("@%d", user.ID)
+}
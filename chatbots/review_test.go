@@ -0,0 +1,67 @@
+package chatbots
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/doylecnn/contribution_bot/storage"
+	"github.com/doylecnn/contribution_bot/telegramtest"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// TestReviewUnreachable reviewers see on the ticket that the contributor blocked the bot
+func TestReviewUnreachable(t *testing.T) {
+	server, s, c := newTestChatBot(t, storage.Settings{ForwardMessageToChatID: testReviewGroupID})
+	ctx := context.Background()
+	_, err := s.CreateNewMessage(ctx, storage.Message{UserID: testContributorID, ChatID: testContributorID,
+		MessageID: 10, ForwardID: 100, Time: time.Now(), Status: storage.StatusForward})
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocked := true
+	server.Handle("sendMessage", func(params url.Values) tgbotapi.APIResponse {
+		if blocked {
+			return telegramtest.Error(403, "Forbidden: bot was blocked by the user", nil)
+		}
+		return tgbotapi.APIResponse{Ok: true, Result: []byte(`{"message_id": 1, "chat": {"id": 42}}`)}
+	})
+	review := func(action string) string {
+		server.Reset()
+		c.handleReviewCallback(&tgbotapi.CallbackQuery{
+			ID:      "1",
+			From:    &tgbotapi.User{ID: testAdminID, FirstName: "bob", LanguageCode: "en"},
+			Message: &tgbotapi.Message{MessageID: 101, Chat: &tgbotapi.Chat{ID: testReviewGroupID, Type: "supergroup"}},
+		}, action, 100)
+		for _, r := range server.Requests() {
+			if r.Method == "editMessageText" && r.ChatID() == testReviewGroupID {
+				return r.Params.Get("text")
+			}
+		}
+		t.Fatalf("%s: ticket not updated", action)
+		return ""
+	}
+
+	ticket := review(reviewChanges)
+	if !strings.Contains(ticket, "can not be reached since") || !strings.Contains(ticket, "blocked by the user") {
+		t.Errorf("ticket %q, want the contributor unreachable", ticket)
+	}
+	first, err := s.GetContributor(ctx, testContributorID)
+	if err != nil || len(first.Unreachable) == 0 {
+		t.Fatalf("contributor = %+v, %v, want unreachable", first, err)
+	}
+
+	// failing again does not move when the contributor became unreachable
+	review(reviewChanges)
+	if again, _ := s.GetContributor(ctx, testContributorID); !again.UnreachableSince.Equal(first.UnreachableSince) {
+		t.Errorf("unreachable since %v, want %v", again.UnreachableSince, first.UnreachableSince)
+	}
+
+	blocked = false
+	c.markReachable(testContributorID)
+	if ticket = review(reviewReject); strings.Contains(ticket, "can not be reached") {
+		t.Errorf("ticket %q, want no unreachable note", ticket)
+	}
+}
@@ -2,6 +2,8 @@ package chatbots
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
 )
@@ -9,29 +11,197 @@ import (
 // CommandHandler handle command
 type CommandHandler func(c ChatBot, message *tgbotapi.Message) (err error)
 
+// Command metadata of a command, shown by /help and in the telegram command menu
+type Command struct {
+	// Name the command without slash, described by cmd_<name> in the catalog
+	Name string
+	// Usage arguments after the command, e.g. "<ticket> <position>"
+	Usage    string
+	Examples []string
+	// Role least admin role allowed to run the command, empty for everyone
+	Role string
+	// ReviewGroup offer the command in the menu of the review group
+	ReviewGroup bool
+
+	// index registration order, /help lists commands in it
+	index int
+}
+
+// UsageLine the command with its arguments
+func (cmd Command) UsageLine() string {
+	if len(cmd.Usage) == 0 {
+		return "/" + cmd.Name
+	}
+	return "/" + cmd.Name + " " + cmd.Usage
+}
+
+// LocalDescription description in the language of languageCode, cmd_<name> in the catalog
+func (cmd Command) LocalDescription(languageCode string) string {
+	return translate(languageCode, "cmd_"+cmd.Name)
+}
+
+// Help detailed help in the language of languageCode
+func (cmd Command) Help(languageCode string) string {
+	lines := []string{cmd.UsageLine(), cmd.LocalDescription(languageCode)}
+	if len(cmd.Role) != 0 {
+		lines = append(lines, translate(languageCode, "required_role", cmd.Role))
+	}
+	if len(cmd.Examples) != 0 {
+		lines = append(lines, "", translate(languageCode, "examples"))
+		lines = append(lines, cmd.Examples...)
+	}
+	return strings.Join(lines, "\n")
+}
+
 type router struct {
-	commands map[string]CommandHandler
+	// username of the bot, group commands addressed to other bots are ignored
+	username string
+	// middlewares run around every command
+	middlewares []Middleware
+	commands    map[string]CommandHandler
+	infos       map[string]Command
 }
 
-func newRouter() router {
-	r := router{}
+func newRouter(username string, middlewares ...Middleware) router {
+	r := router{username: username, middlewares: middlewares}
 	r.commands = make(map[string]CommandHandler)
+	r.infos = make(map[string]Command)
 	return r
 }
 
+// commandList registered commands in registration order
+func (r router) commandList() []Command {
+	cmds := make([]Command, 0, len(r.infos))
+	for _, cmd := range r.infos {
+		cmds = append(cmds, cmd)
+	}
+	sort.Slice(cmds, func(i, j int) bool {
+		return cmds[i].index < cmds[j].index
+	})
+	return cmds
+}
+
+// botCommands cmds for setMyCommands, described in the language of languageCode
+func botCommands(cmds []Command, languageCode string) []BotCommand {
+	commands := make([]BotCommand, len(cmds))
+	for i, cmd := range cmds {
+		commands[i] = BotCommand{Command: cmd.Name, Description: cmd.LocalDescription(languageCode)}
+	}
+	return commands
+}
+
+// addressedToOther the command is /cmd@otherbot in a group
+func (r router) addressedToOther(message *tgbotapi.Message) bool {
+	withAt := message.CommandWithAt()
+	i := strings.Index(withAt, "@")
+	if i == -1 || message.Chat.IsPrivate() || len(r.username) == 0 {
+		return false
+	}
+	return !strings.EqualFold(withAt[i+1:], r.username)
+}
+
 func (r router) run(c ChatBot, message *tgbotapi.Message) (err error) {
-	if !message.IsCommand() {
+	if !message.IsCommand() || r.addressedToOther(message) {
 		return
 	}
 	command := message.Command()
-	if cmd, ok := r.commands[command]; ok {
-		e := cmd(c, message)
-		if e != nil {
-			err = fmt.Errorf("error occurred when running cmd: %s: error is: %w", command, e)
-			return
+	languageCode := message.From.LanguageCode
+	cmd, ok := r.commands[command]
+	if !ok {
+		// in groups a bare /cmd may be meant for another bot
+		if message.Chat.IsPrivate() || strings.Contains(message.CommandWithAt(), "@") {
+			_, err = c.botClient.Send(replyTo(message, translate(languageCode, "unknown_command", command)))
+		}
+		return
+	}
+	e := chain(cmd, r.middlewares...)(c, message)
+	if usage, ok := asUsageError(e); ok {
+		info := r.infos[command]
+		text := usage.Text(languageCode) + "\n" + translate(languageCode, "usage", info.UsageLine())
+		if len(info.Examples) != 0 {
+			text += "\n" + translate(languageCode, "more_help", command)
+		}
+		_, e = c.botClient.Send(replyTo(message, text))
+	}
+	if e != nil {
+		err = fmt.Errorf("error occurred when running cmd: %s: error is: %w", command, e)
+	}
+	return
+}
+
+// replyTo text sent as a reply to message
+func replyTo(message *tgbotapi.Message, text string) tgbotapi.MessageConfig {
+	return tgbotapi.MessageConfig{
+		BaseChat: tgbotapi.BaseChat{
+			ChatID:           message.Chat.ID,
+			ReplyToMessageID: message.MessageID,
+		},
+		Text: text,
+	}
+}
+
+// maxCallbackData telegram rejects inline buttons with longer callback_data
+const maxCallbackData = 64
+
+// CallbackHandler handle callback query, args are the space separated payload after the prefix
+type CallbackHandler func(c ChatBot, query *tgbotapi.CallbackQuery, args []string) (err error)
+
+type callbackRoute struct {
+	// role least admin role allowed to press the button, empty for everyone
+	role    string
+	handler CallbackHandler
+}
+
+type callbackRouter struct {
+	routes map[string]callbackRoute
+}
+
+func newCallbackRouter() callbackRouter {
+	r := callbackRouter{}
+	r.routes = make(map[string]callbackRoute)
+	return r
+}
+
+// callbackData callback_data for a button handled by the handler registered for prefix
+func callbackData(prefix string, args ...interface{}) string {
+	parts := make([]string, len(args))
+	for i, arg := range args {
+		parts[i] = fmt.Sprint(arg)
+	}
+	data := prefix + strings.Join(parts, " ")
+	if len(data) > maxCallbackData {
+		panic(fmt.Sprintf("callback data %q longer than %d bytes", data, maxCallbackData))
+	}
+	return data
+}
+
+// match the route with the longest prefix of data
+func (r callbackRouter) match(data string) (route callbackRoute, args []string, ok bool) {
+	var matched string
+	for prefix, rt := range r.routes {
+		if strings.HasPrefix(data, prefix) && len(prefix) > len(matched) {
+			matched, route, ok = prefix, rt, true
 		}
+	}
+	if ok {
+		args = strings.Fields(data[len(matched):])
+	}
+	return
+}
+
+func (r callbackRouter) run(c ChatBot, query *tgbotapi.CallbackQuery) (err error) {
+	route, args, ok := r.match(query.Data)
+	if !ok {
+		c.botClient.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, translate(query.From.LanguageCode, "button_unsupported")))
+		err = fmt.Errorf("no HandleFunc for callback %s", query.Data)
 		return
 	}
-	err = fmt.Errorf("no HandleFunc for command /%s", command)
+	if len(route.role) != 0 && !c.hasRole(query.From.ID, route.role) {
+		c.botClient.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, translate(query.From.LanguageCode, "permission_denied")))
+		return
+	}
+	if e := route.handler(c, query, args); e != nil {
+		err = fmt.Errorf("error occurred when running callback: %s: error is: %w", query.Data, e)
+	}
 	return
 }
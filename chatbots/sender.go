@@ -0,0 +1,303 @@
+package chatbots
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/doylecnn/contribution_bot/storage"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/rs/zerolog"
+)
+
+const (
+	sendAttempts = 4
+	// maxRetryAfter longest retry_after honored before giving up
+	maxRetryAfter = time.Minute
+)
+
+// SendPacing how the bot spaces and retries its requests to telegram
+type SendPacing struct {
+	// Global between any two messages
+	Global time.Duration
+	// Private between messages to the same private chat
+	Private time.Duration
+	// Group between messages to the same group or channel
+	Group time.Duration
+	// FirstBackoff wait before the first retry, doubled for every further one
+	FirstBackoff time.Duration
+	// Sleep waits, time.Sleep when nil
+	Sleep func(time.Duration)
+}
+
+// telegramPacing telegram allows about 30 messages per second overall, one per
+// second in a private chat and 20 per minute in a group
+var telegramPacing = SendPacing{
+	Global:       time.Second / 30,
+	Private:      time.Second,
+	Group:        time.Minute / 20,
+	FirstBackoff: time.Second,
+}
+
+// sender the single outbound path to telegram. it spaces messages to stay under
+// telegram's limits, honors retry_after, retries transient failures with
+// backoff, and records messages that still fail as dead letters
+type sender struct {
+	client  TelegramClient
+	storage storage.Storage
+	logger  zerolog.Logger
+
+	pacing SendPacing
+	global *pacer
+	mu     sync.Mutex
+	chats  map[int64]*pacer
+}
+
+var _ TelegramClient = (*sender)(nil)
+
+func newSender(client TelegramClient, s storage.Storage, logger zerolog.Logger, pacing SendPacing) *sender {
+	if pacing.Sleep == nil {
+		pacing.Sleep = time.Sleep
+	}
+	return &sender{
+		client:  client,
+		storage: s,
+		logger:  logger,
+		pacing:  pacing,
+		global:  &pacer{interval: pacing.Global, sleep: pacing.Sleep},
+		chats:   make(map[int64]*pacer),
+	}
+}
+
+// Send send c, see sender
+func (s *sender) Send(c tgbotapi.Chattable) (msg tgbotapi.Message, err error) {
+	chatID, method := chattableChatID(c), chattableMethod(c)
+	err = s.do(method, chatID, func() (e error) {
+		msg, e = s.client.Send(c)
+		return
+	})
+	if err != nil && isSendEndpoint(method) {
+		s.deadLetter(method, chatID, c, err)
+	}
+	return
+}
+
+// MakeRequest make request, see sender
+func (s *sender) MakeRequest(endpoint string, params url.Values) (resp tgbotapi.APIResponse, err error) {
+	// long polling waits on purpose and has its own retry loop
+	if endpoint == "getUpdates" {
+		return s.client.MakeRequest(endpoint, params)
+	}
+	var chatID int64
+	if isSendEndpoint(endpoint) {
+		chatID, _ = strconv.ParseInt(params.Get("chat_id"), 10, 64)
+	}
+	err = s.do(endpoint, chatID, func() (e error) {
+		resp, e = s.client.MakeRequest(endpoint, params)
+		return
+	})
+	if err != nil && isSendEndpoint(endpoint) {
+		s.deadLetter(endpoint, chatID, params, err)
+	}
+	return
+}
+
+// UploadFile upload file, see sender
+func (s *sender) UploadFile(endpoint string, params map[string]string, fieldname string, file interface{}) (resp tgbotapi.APIResponse, err error) {
+	chatID, _ := strconv.ParseInt(params["chat_id"], 10, 64)
+	err = s.do(endpoint, chatID, func() (e error) {
+		resp, e = s.client.UploadFile(endpoint, params, fieldname, file)
+		return
+	})
+	if err != nil && isSendEndpoint(endpoint) {
+		s.deadLetter(endpoint, chatID, params, err)
+	}
+	return
+}
+
+// DeleteMessage delete message, see sender
+func (s *sender) DeleteMessage(config tgbotapi.DeleteMessageConfig) (resp tgbotapi.APIResponse, err error) {
+	err = s.do("deleteMessage", 0, func() (e error) {
+		resp, e = s.client.DeleteMessage(config)
+		return
+	})
+	return
+}
+
+// AnswerCallbackQuery answer callback query, see sender
+func (s *sender) AnswerCallbackQuery(config tgbotapi.CallbackConfig) (resp tgbotapi.APIResponse, err error) {
+	err = s.do("answerCallbackQuery", 0, func() (e error) {
+		resp, e = s.client.AnswerCallbackQuery(config)
+		return
+	})
+	return
+}
+
+// GetWebhookInfo get webhook info, see sender
+func (s *sender) GetWebhookInfo() (info tgbotapi.WebhookInfo, err error) {
+	err = s.do("getWebhookInfo", 0, func() (e error) {
+		info, e = s.client.GetWebhookInfo()
+		return
+	})
+	return
+}
+
+// do call f for method, paced for chatID when it is not 0, retrying as described on sender
+func (s *sender) do(method string, chatID int64, f func() error) (err error) {
+	backoff := s.pacing.FirstBackoff
+	for attempt := 1; ; attempt++ {
+		if chatID != 0 {
+			s.global.wait()
+			s.chatPacer(chatID).wait()
+		}
+		if err = f(); err == nil || attempt == sendAttempts {
+			return
+		}
+		delay, retry := retryDelay(method, err, backoff)
+		if !retry {
+			return
+		}
+		s.logger.Warn().Err(err).Str("method", method).Int64("chatID", chatID).Int("attempt", attempt).
+			Dur("retryIn", delay).Msg("telegram request failed, retrying")
+		s.pacing.Sleep(delay)
+		backoff *= 2
+	}
+}
+
+// retryDelay how long to wait before retrying method after err. telegram errors are
+// final unless they carry retry_after. other errors are network trouble, where a
+// message may have arrived already, so sending is only retried when the request
+// never left
+func retryDelay(method string, err error, backoff time.Duration) (delay time.Duration, retry bool) {
+	apiErr, ok := err.(tgbotapi.Error)
+	if !ok {
+		return backoff, !isSendEndpoint(method) || notSent(err)
+	}
+	if apiErr.RetryAfter <= 0 {
+		return 0, false
+	}
+	delay = time.Duration(apiErr.RetryAfter) * time.Second
+	return delay, delay <= maxRetryAfter
+}
+
+// notSent err happened before the request reached telegram, e.g. resolving or connecting failed
+func notSent(err error) bool {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+func (s *sender) chatPacer(chatID int64) *pacer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.chats[chatID]
+	if !ok {
+		// forget idle chats now and then
+		if len(s.chats) > 1000 {
+			idle := time.Now().Add(-time.Minute)
+			for id, p := range s.chats {
+				if p.idleSince(idle) {
+					delete(s.chats, id)
+				}
+			}
+		}
+		interval := s.pacing.Private
+		if chatID < 0 {
+			interval = s.pacing.Group
+		}
+		p = &pacer{interval: interval, sleep: s.pacing.Sleep}
+		s.chats[chatID] = p
+	}
+	return p
+}
+
+func (s *sender) deadLetter(method string, chatID int64, payload interface{}, err error) {
+	if migratedChatID(err) != 0 {
+		// not lost, callers send it again to the supergroup
+		return
+	}
+	data, _ := json.Marshal(payload)
+	s.logger.Error().Err(err).Str("method", method).Int64("chatID", chatID).Msg("telegram request failed for good")
+	e := s.storage.SaveDeadLetter(context.Background(), storage.DeadLetter{
+		Method:   method,
+		ChatID:   chatID,
+		Payload:  string(data),
+		Error:    err.Error(),
+		FailedAt: time.Now(),
+	})
+	if e != nil {
+		s.logger.Error().Err(e).Msg("save dead letter failed")
+	}
+}
+
+// pacer lets calls through at most once per interval
+type pacer struct {
+	mu       sync.Mutex
+	interval time.Duration
+	sleep    func(time.Duration)
+	next     time.Time
+}
+
+func (p *pacer) wait() {
+	p.mu.Lock()
+	now := time.Now()
+	if p.next.Before(now) {
+		p.next = now
+	}
+	delay := p.next.Sub(now)
+	p.next = p.next.Add(p.interval)
+	p.mu.Unlock()
+	p.sleep(delay)
+}
+
+func (p *pacer) idleSince(t time.Time) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.next.Before(t)
+}
+
+// isSendEndpoint methods which put a message into a chat
+func isSendEndpoint(endpoint string) bool {
+	return strings.HasPrefix(endpoint, "send") ||
+		endpoint == "forwardMessage" ||
+		endpoint == "copyMessage"
+}
+
+// chattableChatID chat of the configs the bot sends, 0 for others
+func chattableChatID(c tgbotapi.Chattable) int64 {
+	switch config := c.(type) {
+	case tgbotapi.MessageConfig:
+		return config.ChatID
+	case tgbotapi.ForwardConfig:
+		return config.ChatID
+	case tgbotapi.EditMessageTextConfig:
+		return config.ChatID
+	case tgbotapi.EditMessageReplyMarkupConfig:
+		return config.ChatID
+	}
+	return 0
+}
+
+func chattableMethod(c tgbotapi.Chattable) string {
+	switch c.(type) {
+	case tgbotapi.MessageConfig:
+		return "sendMessage"
+	case tgbotapi.ForwardConfig:
+		return "forwardMessage"
+	case tgbotapi.EditMessageTextConfig:
+		return "editMessageText"
+	case tgbotapi.EditMessageReplyMarkupConfig:
+		return "editMessageReplyMarkup"
+	}
+	return "send"
+}
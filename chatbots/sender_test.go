@@ -0,0 +1,142 @@
+package chatbots
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/doylecnn/contribution_bot/storage"
+	"github.com/doylecnn/contribution_bot/telegramtest"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/rs/zerolog"
+)
+
+// abort drops the connection instead of answering, after telegram may have got the request
+var abort *tgbotapi.APIResponse
+
+func retryAfter(seconds int) *tgbotapi.APIResponse {
+	resp := telegramtest.Error(429, "Too Many Requests: retry after", &tgbotapi.ResponseParameters{RetryAfter: seconds})
+	return &resp
+}
+
+func apiError(code int, description string, parameters *tgbotapi.ResponseParameters) *tgbotapi.APIResponse {
+	resp := telegramtest.Error(code, description, parameters)
+	return &resp
+}
+
+// newTestSender a sender whose waits are recorded instead of slept
+func newTestSender(client TelegramClient) (*sender, storage.Storage, *[]time.Duration) {
+	s := storage.NewMemoryStorage()
+	var sleeps []time.Duration
+	return newSender(client, s, zerolog.Nop(), SendPacing{
+		FirstBackoff: time.Second,
+		Sleep: func(d time.Duration) {
+			if d > 0 {
+				sleeps = append(sleeps, d)
+			}
+		},
+	}), s, &sleeps
+}
+
+func TestSenderRetry(t *testing.T) {
+	tests := []struct {
+		name string
+		edit bool
+		// responses answers of the first attempts, later ones succeed
+		responses  []*tgbotapi.APIResponse
+		requests   int
+		sleeps     []time.Duration
+		deadLetter bool
+	}{
+		{name: "ok", requests: 1},
+		{name: "retry_after", responses: []*tgbotapi.APIResponse{retryAfter(3)},
+			requests: 2, sleeps: []time.Duration{3 * time.Second}},
+		{name: "retry_after every attempt", responses: []*tgbotapi.APIResponse{retryAfter(1), retryAfter(1), retryAfter(1), retryAfter(1)},
+			requests: sendAttempts, sleeps: []time.Duration{time.Second, time.Second, time.Second}, deadLetter: true},
+		{name: "retry_after too long", responses: []*tgbotapi.APIResponse{retryAfter(int(maxRetryAfter/time.Second) + 1)},
+			requests: 1, deadLetter: true},
+		{name: "blocked", responses: []*tgbotapi.APIResponse{apiError(403, "Forbidden: bot was blocked by the user", nil)},
+			requests: 1, deadLetter: true},
+		{name: "migrated", responses: []*tgbotapi.APIResponse{apiError(400, "Bad Request: group chat was upgraded to a supergroup chat",
+			&tgbotapi.ResponseParameters{MigrateToChatID: -1002})},
+			requests: 1},
+		{name: "connection lost while sending", responses: []*tgbotapi.APIResponse{abort},
+			requests: 1, deadLetter: true},
+		{name: "connection lost while editing", edit: true, responses: []*tgbotapi.APIResponse{abort, abort, abort},
+			requests: 4, sleeps: []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := telegramtest.NewServer()
+			defer server.Close()
+			responses := tt.responses
+			answer := func(params url.Values) tgbotapi.APIResponse {
+				if len(responses) == 0 {
+					result, _ := json.Marshal(tgbotapi.Message{MessageID: 1, Chat: &tgbotapi.Chat{ID: testContributorID}})
+					return tgbotapi.APIResponse{Ok: true, Result: result}
+				}
+				resp := responses[0]
+				responses = responses[1:]
+				if resp == abort {
+					panic(http.ErrAbortHandler)
+				}
+				return *resp
+			}
+			server.Handle("sendMessage", answer)
+			server.Handle("editMessageText", answer)
+			client, err := server.NewClient("test-token")
+			if err != nil {
+				t.Fatal(err)
+			}
+			sender, s, sleeps := newTestSender(client)
+			server.Reset()
+
+			if tt.edit {
+				_, err = sender.Send(tgbotapi.NewEditMessageText(testContributorID, 1, "edited"))
+			} else {
+				_, err = sender.Send(tgbotapi.NewMessage(testContributorID, "hello"))
+			}
+			if failed := len(tt.responses) >= tt.requests; failed != (err != nil) {
+				t.Errorf("err = %v, want failed %v", err, failed)
+			}
+			if got := len(server.Requests()); got != tt.requests {
+				t.Errorf("%d requests, want %d", got, tt.requests)
+			}
+			if !reflect.DeepEqual(*sleeps, tt.sleeps) {
+				t.Errorf("waited %v, want %v", *sleeps, tt.sleeps)
+			}
+			letters, err := s.ListDeadLetters(context.Background(), 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := len(letters) == 1; got != tt.deadLetter {
+				t.Errorf("dead letters %+v, want dead letter %v", letters, tt.deadLetter)
+			}
+		})
+	}
+}
+
+// TestSenderNeverSent messages that could not reach telegram at all are retried with backoff
+func TestSenderNeverSent(t *testing.T) {
+	server := telegramtest.NewServer()
+	client, err := server.NewClient("test-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Close()
+	sender, s, sleeps := newTestSender(client)
+
+	if _, err = sender.Send(tgbotapi.NewMessage(testContributorID, "hello")); err == nil {
+		t.Fatal("send to a closed server succeeded")
+	}
+	if want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}; !reflect.DeepEqual(*sleeps, want) {
+		t.Errorf("waited %v, want %v", *sleeps, want)
+	}
+	if letters, _ := s.ListDeadLetters(context.Background(), 10); len(letters) != 1 {
+		t.Errorf("dead letters %+v, want one", letters)
+	}
+}
@@ -0,0 +1,113 @@
+package chatbots
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/doylecnn/contribution_bot/storage"
+)
+
+// settingsTTL how long cached settings are used before they are reloaded from storage,
+// changes made through another instance show up within this time
+const settingsTTL = time.Minute
+
+// settingsCache concurrency safe settings shared by all copies of ChatBot
+type settingsCache struct {
+	storage storage.Storage
+	ttl     time.Duration
+
+	mu       sync.RWMutex
+	settings storage.Settings
+	err      error
+	loadedAt time.Time
+	onChange []func(old, new storage.Settings)
+}
+
+func newSettingsCache(s storage.Storage, ttl time.Duration) *settingsCache {
+	return &settingsCache{storage: s, ttl: ttl}
+}
+
+// OnChange call fn whenever settings change, by an admin or on reload
+func (sc *settingsCache) OnChange(fn func(old, new storage.Settings)) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.onChange = append(sc.onChange, fn)
+}
+
+// Get cached settings, storage.ErrSettingsNotFound until they are saved once
+func (sc *settingsCache) Get(ctx context.Context) (settings storage.Settings, err error) {
+	sc.mu.RLock()
+	if !sc.loadedAt.IsZero() && time.Since(sc.loadedAt) < sc.ttl {
+		settings, err = sc.settings, sc.err
+		sc.mu.RUnlock()
+		return
+	}
+	sc.mu.RUnlock()
+	return sc.load(ctx, false)
+}
+
+// Reload read settings from storage now
+func (sc *settingsCache) Reload(ctx context.Context) (storage.Settings, error) {
+	return sc.load(ctx, true)
+}
+
+func (sc *settingsCache) load(ctx context.Context, force bool) (settings storage.Settings, err error) {
+	sc.mu.Lock()
+	if !force && !sc.loadedAt.IsZero() && time.Since(sc.loadedAt) < sc.ttl {
+		// another goroutine reloaded while we waited for the lock
+		settings, err = sc.settings, sc.err
+		sc.mu.Unlock()
+		return
+	}
+	old := sc.settings
+	settings, err = sc.storage.GetSettings(ctx)
+	if err != nil && err != storage.ErrSettingsNotFound {
+		// keep serving what we have, try again on the next call
+		if !sc.loadedAt.IsZero() {
+			settings, err = sc.settings, sc.err
+		}
+		sc.mu.Unlock()
+		return
+	}
+	sc.settings, sc.err, sc.loadedAt = settings, err, time.Now()
+	handlers := sc.onChange
+	sc.mu.Unlock()
+
+	if !reflect.DeepEqual(settings, old) {
+		for _, fn := range handlers {
+			fn(old, settings)
+		}
+	}
+	return
+}
+
+// Update apply fn to the current settings and save them, nothing is saved when fn fails
+func (sc *settingsCache) Update(ctx context.Context, fn func(settings *storage.Settings) error) (settings storage.Settings, err error) {
+	sc.mu.Lock()
+	old := sc.settings
+	settings, err = sc.storage.GetSettings(ctx)
+	if err != nil && err != storage.ErrSettingsNotFound {
+		sc.mu.Unlock()
+		return
+	}
+	if err = fn(&settings); err != nil {
+		sc.mu.Unlock()
+		return
+	}
+	if err = sc.storage.SaveSettings(ctx, settings); err != nil {
+		sc.mu.Unlock()
+		return
+	}
+	sc.settings, sc.err, sc.loadedAt = settings, nil, time.Now()
+	handlers := sc.onChange
+	sc.mu.Unlock()
+
+	if !reflect.DeepEqual(settings, old) {
+		for _, fn := range handlers {
+			fn(old, settings)
+		}
+	}
+	return
+}
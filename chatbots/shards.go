@@ -0,0 +1,74 @@
+package chatbots
+
+import (
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// inboxItem a claimed update on its way to a worker
+type inboxItem struct {
+	update tgbotapi.Update
+	// claimedUntil lease of the claim, the worker renews it before handling
+	claimedUntil time.Time
+}
+
+// updateShards one channel per worker. all updates of a chat go to the same
+// worker, so a chat is handled in order while different chats run in parallel
+type updateShards []chan inboxItem
+
+func newUpdateShards(workers, buffer int) updateShards {
+	if workers < 1 {
+		workers = 1
+	}
+	size := buffer / workers
+	if size < 1 {
+		size = 1
+	}
+	shards := make(updateShards, workers)
+	for i := range shards {
+		shards[i] = make(chan inboxItem, size)
+	}
+	return shards
+}
+
+// index the shard of chatID
+func (s updateShards) index(chatID int64) int {
+	if chatID < 0 {
+		chatID = -chatID
+	}
+	return int(chatID % int64(len(s)))
+}
+
+// trySend queue item on the shard of its chat, false when that shard is full
+func (s updateShards) trySend(item inboxItem) bool {
+	select {
+	case s[s.index(updateChatID(item.update))] <- item:
+		return true
+	default:
+		return false
+	}
+}
+
+// free room left in each shard
+func (s updateShards) free() []int {
+	room := make([]int, len(s))
+	for i, ch := range s {
+		room[i] = cap(ch) - len(ch)
+	}
+	return room
+}
+
+// updateChatID the chat an update belongs to, callback queries belong to the
+// chat of their message
+func updateChatID(update tgbotapi.Update) int64 {
+	switch {
+	case update.Message != nil && update.Message.Chat != nil:
+		return update.Message.Chat.ID
+	case update.CallbackQuery != nil && update.CallbackQuery.Message != nil && update.CallbackQuery.Message.Chat != nil:
+		return update.CallbackQuery.Message.Chat.ID
+	case update.CallbackQuery != nil && update.CallbackQuery.From != nil:
+		return int64(update.CallbackQuery.From.ID)
+	}
+	return 0
+}
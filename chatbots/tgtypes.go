@@ -14,8 +14,35 @@ type BotCommand struct {
 	Description string `json:"description"`
 }
 
-func (c ChatBot) setMyCommands(commands []BotCommand) (response tgbotapi.APIResponse, err error) {
-	v := url.Values{}
+// BotCommandScope which users see a command menu
+type BotCommandScope struct {
+	// Type default, all_private_chats, all_group_chats, all_chat_administrators, chat, chat_administrators or chat_member
+	Type   string `json:"type"`
+	ChatID int64  `json:"chat_id,omitempty"`
+	UserID int    `json:"user_id,omitempty"`
+}
+
+// commandsParams scope and language_code of the *MyCommands methods, nil scope is the default scope
+func commandsParams(scope *BotCommandScope, languageCode string) (v url.Values, err error) {
+	v = url.Values{}
+	if scope != nil {
+		var data []byte
+		if data, err = json.Marshal(scope); err != nil {
+			return
+		}
+		v.Add("scope", string(data))
+	}
+	if len(languageCode) != 0 {
+		v.Add("language_code", languageCode)
+	}
+	return
+}
+
+func (c ChatBot) setMyCommands(commands []BotCommand, scope *BotCommandScope, languageCode string) (response tgbotapi.APIResponse, err error) {
+	v, err := commandsParams(scope, languageCode)
+	if err != nil {
+		return
+	}
 	var data []byte
 	if data, err = json.Marshal(commands); err == nil {
 		v.Add("commands", string(data))
@@ -26,8 +53,31 @@ func (c ChatBot) setMyCommands(commands []BotCommand) (response tgbotapi.APIResp
 	return c.botClient.MakeRequest("setMyCommands", v)
 }
 
-func (c ChatBot) getMyCommands() (commands []BotCommand, err error) {
-	v := url.Values{}
+func (c ChatBot) deleteMyCommands(scope *BotCommandScope, languageCode string) (response tgbotapi.APIResponse, err error) {
+	v, err := commandsParams(scope, languageCode)
+	if err != nil {
+		return
+	}
+	return c.botClient.MakeRequest("deleteMyCommands", v)
+}
+
+// botUsername username of the bot behind client
+func botUsername(client TelegramClient) (username string, err error) {
+	resp, err := client.MakeRequest("getMe", url.Values{})
+	if err != nil {
+		return
+	}
+	var user tgbotapi.User
+	err = json.Unmarshal(resp.Result, &user)
+	username = user.UserName
+	return
+}
+
+func (c ChatBot) getMyCommands(scope *BotCommandScope, languageCode string) (commands []BotCommand, err error) {
+	v, err := commandsParams(scope, languageCode)
+	if err != nil {
+		return
+	}
 	resp, err := c.botClient.MakeRequest("getMyCommands", v)
 	if err != nil {
 		return
@@ -41,6 +91,8 @@ func (c ChatBot) getMyCommands() (commands []BotCommand, err error) {
 type WebhookConfig struct {
 	tgbotapi.WebhookConfig
 	AllowedUpdates []string
+	// SecretToken sent back by telegram in the X-Telegram-Bot-Api-Secret-Token header
+	SecretToken string
 }
 
 // SetWebhook sets a webhook.
@@ -59,6 +111,9 @@ func (c ChatBot) setWebhook(config WebhookConfig) (tgbotapi.APIResponse, error)
 		if len(config.AllowedUpdates) != 0 {
 			v["allowed_updates"] = config.AllowedUpdates
 		}
+		if len(config.SecretToken) != 0 {
+			v.Add("secret_token", config.SecretToken)
+		}
 
 		return c.botClient.MakeRequest("setWebhook", v)
 	}
@@ -68,6 +123,9 @@ func (c ChatBot) setWebhook(config WebhookConfig) (tgbotapi.APIResponse, error)
 	if config.MaxConnections != 0 {
 		params["max_connections"] = strconv.Itoa(config.MaxConnections)
 	}
+	if len(config.SecretToken) != 0 {
+		params["secret_token"] = config.SecretToken
+	}
 
 	resp, err := c.botClient.UploadFile("setWebhook", params, "certificate", config.Certificate)
 	if err != nil {
@@ -80,3 +138,67 @@ func (c ChatBot) setWebhook(config WebhookConfig) (tgbotapi.APIResponse, error)
 func (c ChatBot) deleteWebhook() (tgbotapi.APIResponse, error) {
 	return c.botClient.MakeRequest("deleteWebhook", url.Values{})
 }
+
+// getUpdates returns the raw updates, so they can be stored as received
+func (c ChatBot) getUpdates(offset, timeout int, allowedUpdates []string) (updates []json.RawMessage, err error) {
+	v := url.Values{}
+	if offset != 0 {
+		v.Add("offset", strconv.Itoa(offset))
+	}
+	if timeout > 0 {
+		v.Add("timeout", strconv.Itoa(timeout))
+	}
+	if len(allowedUpdates) != 0 {
+		var data []byte
+		if data, err = json.Marshal(allowedUpdates); err != nil {
+			return
+		}
+		v.Add("allowed_updates", string(data))
+	}
+	resp, err := c.botClient.MakeRequest("getUpdates", v)
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(resp.Result, &updates)
+	return
+}
+
+// CopyMessageConfig contains information about a copyMessage request.
+type CopyMessageConfig struct {
+	ChatID           int64
+	FromChatID       int64
+	MessageID        int
+	ReplyToMessageID int
+	ReplyMarkup      interface{}
+}
+
+// copyMessage copy any kind of message, keeping caption and entities,
+// without a link to the original message. returns the id of the copy
+func (c ChatBot) copyMessage(config CopyMessageConfig) (messageID int, err error) {
+	v := url.Values{}
+	v.Add("chat_id", strconv.FormatInt(config.ChatID, 10))
+	v.Add("from_chat_id", strconv.FormatInt(config.FromChatID, 10))
+	v.Add("message_id", strconv.Itoa(config.MessageID))
+	if config.ReplyToMessageID != 0 {
+		v.Add("reply_to_message_id", strconv.Itoa(config.ReplyToMessageID))
+	}
+	if config.ReplyMarkup != nil {
+		var data []byte
+		if data, err = json.Marshal(config.ReplyMarkup); err != nil {
+			return
+		}
+		v.Add("reply_markup", string(data))
+	}
+	resp, err := c.botClient.MakeRequest("copyMessage", v)
+	if err != nil {
+		return
+	}
+
+	var result struct {
+		MessageID int `json:"message_id"`
+	}
+	err = json.Unmarshal(resp.Result, &result)
+	messageID = result.MessageID
+	return
+}
@@ -0,0 +1,48 @@
+package chatbots
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/doylecnn/contribution_bot/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// secretTokenHeader telegram puts the webhook secret_token in this header
+const secretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// initWebhook load the webhook path and secret token shared by all instances,
+// generating them on first start
+func (c ChatBot) initWebhook() (webhook storage.Webhook, err error) {
+	if webhook.Path, err = randomToken(); err != nil {
+		return
+	}
+	if webhook.SecretToken, err = randomToken(); err != nil {
+		return
+	}
+	return c.storage.InitWebhook(context.Background(), webhook)
+}
+
+// requireSecretToken reject requests without the webhook secret token
+func requireSecretToken(secretToken string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		got := ctx.GetHeader(secretTokenHeader)
+		if subtle.ConstantTimeCompare([]byte(got), []byte(secretToken)) != 1 {
+			ctx.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// randomToken 32 random bytes hex encoded, valid as url path and secret_token
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -6,34 +6,63 @@ import (
 	"strconv"
 
 	"github.com/doylecnn/contribution_bot/chatbots"
+	"github.com/doylecnn/contribution_bot/storage"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
 
 type env struct {
-	Port       string
-	BotToken   string
-	BotAdminID int
-	AppID      string
-	Domain     string
-	ProjectID  string
+	Port        string
+	BotToken    string
+	BotAdminID  int
+	AppID       string
+	Domain      string
+	ProjectID   string
+	Storage     string
+	StoragePath string
+	Polling     bool
+	Workers     int
 }
 
 func main() {
 	zerolog.SetGlobalLevel(zerolog.DebugLevel)
 	env := readEnv()
 
-	bot := chatbots.NewChatBot(env.BotToken,
-		env.Domain,
-		env.AppID,
-		env.ProjectID,
-		env.Port,
-		env.BotAdminID)
+	s := newStorage(env)
+	bot := chatbots.NewChatBot(chatbots.Config{
+		Token:     env.BotToken,
+		Domain:    env.Domain,
+		AppID:     env.AppID,
+		ProjectID: env.ProjectID,
+		Port:      env.Port,
+		AdminID:   env.BotAdminID,
+		Polling:   env.Polling,
+		Workers:   env.Workers,
+	}, s)
 	defer bot.Close()
 
 	bot.Run()
 }
 
+func newStorage(env env) storage.Storage {
+	switch env.Storage {
+	case "bolt":
+		s, err := storage.NewBoltStorage(env.StoragePath)
+		if err != nil {
+			log.Logger.Fatal().Err(err).Str("path", env.StoragePath).Msg("open bolt storage failed")
+		}
+		return s
+	case "memory":
+		return storage.NewMemoryStorage()
+	default:
+		s, err := storage.NewStorage(env.ProjectID)
+		if err != nil {
+			log.Logger.Fatal().Err(err).Str("projectID", env.ProjectID).Msg("connect firestore failed")
+		}
+		return s
+	}
+}
+
 func readEnv() env {
 	port := os.Getenv("PORT")
 	if len(port) == 0 {
@@ -53,22 +82,58 @@ func readEnv() env {
 		log.Logger.Fatal().Err(err).Send()
 	}
 
+	// STORAGE selects the backend: firestore (default), bolt or memory
+	storageBackend := os.Getenv("STORAGE")
+	switch storageBackend {
+	case "":
+		storageBackend = "firestore"
+	case "firestore", "bolt", "memory":
+	default:
+		log.Logger.Fatal().Str("STORAGE", storageBackend).Msg("unknown storage backend")
+	}
+	storagePath := os.Getenv("STORAGE_PATH")
+	if len(storagePath) == 0 {
+		storagePath = "contribution_bot.db"
+	}
+	onGCP := storageBackend == "firestore"
+
 	appID := os.Getenv("GAE_APPLICATION")
 	if len(appID) == 0 {
-		log.Logger.Fatal().Msg("no env var: GAE_APPLICATION")
+		if onGCP {
+			log.Logger.Fatal().Msg("no env var: GAE_APPLICATION")
+		}
+	} else {
+		appID = appID[2:]
 	}
-	appID = appID[2:]
 	log.Logger.Info().Str("appID", appID).Send()
 
 	projectID := os.Getenv("PROJECT_ID")
-	if len(projectID) == 0 {
+	if len(projectID) == 0 && onGCP {
 		log.Logger.Fatal().Msg("no env var: PROJECT_ID")
 	}
 
+	// UPDATE_MODE selects how updates are received: webhook (default) or polling
+	var polling bool
+	switch updateMode := os.Getenv("UPDATE_MODE"); updateMode {
+	case "", "webhook":
+	case "polling":
+		polling = true
+	default:
+		log.Logger.Fatal().Str("UPDATE_MODE", updateMode).Msg("unknown update mode")
+	}
+
+	// WORKERS number of goroutines handling updates
+	workers := 2
+	if w := os.Getenv("WORKERS"); len(w) != 0 {
+		if workers, err = strconv.Atoi(w); err != nil || workers < 1 {
+			log.Logger.Fatal().Err(err).Str("WORKERS", w).Msg("WORKERS must be a positive number")
+		}
+	}
+
 	domain := os.Getenv("DOMAIN")
-	if len(domain) == 0 {
+	if len(domain) == 0 && !polling {
 		log.Logger.Fatal().Msg("no env var: DOMAIN")
 	}
 
-	return env{port, token, int(botAdminID), appID, domain, projectID}
+	return env{port, token, int(botAdminID), appID, domain, projectID, storageBackend, storagePath, polling, workers}
 }
@@ -0,0 +1,630 @@
+package storage
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+var (
+	boltMessagesBucket = []byte("messages")
+	boltSettingsBucket = []byte("settings")
+	boltSettingsKey    = []byte("setting")
+	boltAdminsBucket   = []byte("admins")
+	boltBansBucket     = []byte("bans")
+	boltContribsBucket = []byte("contributors")
+	boltConvsBucket    = []byte("conversations")
+	boltCountersBucket = []byte("counters")
+	boltInboxBucket    = []byte("inbox")
+	boltLettersBucket  = []byte("dead_letters")
+	boltQueueBucket    = []byte("publish_queue")
+	boltQueueStateKey  = []byte("publish_queue")
+	boltWebhookKey     = []byte("webhook")
+)
+
+// BoltStorage storage backed by a local bbolt database file, for self-hosting
+type BoltStorage struct {
+	db *bbolt.DB
+}
+
+var _ Storage = (*BoltStorage)(nil)
+
+// NewBoltStorage open or create the database file at path
+func NewBoltStorage(path string) (*BoltStorage, error) {
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		for _, name := range [][]byte{boltMessagesBucket, boltSettingsBucket, boltAdminsBucket, boltBansBucket, boltContribsBucket, boltConvsBucket, boltCountersBucket, boltInboxBucket, boltLettersBucket, boltQueueBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltStorage{db: db}, nil
+}
+
+// Close close storage object
+func (s *BoltStorage) Close() {
+	s.db.Close()
+}
+
+// CreateNewMessage save user new message, or overwrite the one saved for the same chat and message id
+func (s *BoltStorage) CreateNewMessage(ctx context.Context, message Message) (id string, err error) {
+	err = s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(boltMessagesBucket)
+		err := b.ForEach(func(k, v []byte) error {
+			var msg Message
+			if err := json.Unmarshal(v, &msg); err != nil {
+				return err
+			}
+			if msg.ChatID == message.ChatID && msg.MessageID == message.MessageID {
+				id = string(k)
+				return errStopIteration
+			}
+			return nil
+		})
+		if err != nil && err != errStopIteration {
+			return err
+		}
+		if len(id) == 0 {
+			seq, err := b.NextSequence()
+			if err != nil {
+				return err
+			}
+			id = strconv.FormatUint(seq, 10)
+		}
+		message.ID = id
+		message.TimeStamp = message.Time.Unix()
+		return putJSON(b, []byte(id), message)
+	})
+	return
+}
+
+// GetMessage by forwardID
+func (s *BoltStorage) GetMessage(ctx context.Context, forwardID int) (originMsg Message, err error) {
+	err = s.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(boltMessagesBucket).ForEach(func(k, v []byte) error {
+			var msg Message
+			if err := json.Unmarshal(v, &msg); err != nil {
+				return err
+			}
+			if msg.ForwardID == forwardID {
+				originMsg = msg
+				return errStopIteration
+			}
+			return nil
+		})
+	})
+	if err == errStopIteration {
+		return originMsg, nil
+	}
+	if err == nil {
+		err = ErrMessageNotFound
+	}
+	return
+}
+
+// GetLatestMessage the last message of the user that reached the review group
+func (s *BoltStorage) GetLatestMessage(ctx context.Context, userID int) (message Message, err error) {
+	var messages []Message
+	err = s.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(boltMessagesBucket).ForEach(func(k, v []byte) error {
+			var msg Message
+			if err := json.Unmarshal(v, &msg); err != nil {
+				return err
+			}
+			if msg.UserID == userID {
+				messages = append(messages, msg)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return
+	}
+	return latestMessage(messages)
+}
+
+// UpdateMessageStatus update message status
+func (s *BoltStorage) UpdateMessageStatus(ctx context.Context, message Message) (err error) {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(boltMessagesBucket)
+		v := b.Get([]byte(message.ID))
+		if v == nil {
+			return ErrMessageNotFound
+		}
+		var msg Message
+		if err := json.Unmarshal(v, &msg); err != nil {
+			return err
+		}
+		msg.ForwardID = message.ForwardID
+		msg.Status = message.Status
+		return putJSON(b, []byte(message.ID), msg)
+	})
+}
+
+// DeleteOldForwardMessages delete old messages
+func (s *BoltStorage) DeleteOldForwardMessages(ctx context.Context) (err error) {
+	deadline := time.Now().Add(-forwardedMessageTTL).Unix()
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(boltMessagesBucket)
+		var keys [][]byte
+		err := b.ForEach(func(k, v []byte) error {
+			var msg Message
+			if err := json.Unmarshal(v, &msg); err != nil {
+				return err
+			}
+			if msg.TimeStamp < deadline && isPurgeable(msg.Status) {
+				keys = append(keys, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SaveSettings save settings
+func (s *BoltStorage) SaveSettings(ctx context.Context, settings Settings) (err error) {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return putJSON(tx.Bucket(boltSettingsBucket), boltSettingsKey, settings)
+	})
+}
+
+// GetSettings get settings
+func (s *BoltStorage) GetSettings(ctx context.Context) (settings Settings, err error) {
+	err = s.db.View(func(tx *bbolt.Tx) error {
+		v := tx.Bucket(boltSettingsBucket).Get(boltSettingsKey)
+		if v == nil {
+			return ErrSettingsNotFound
+		}
+		return json.Unmarshal(v, &settings)
+	})
+	return
+}
+
+// GetAdmins all admins
+func (s *BoltStorage) GetAdmins(ctx context.Context) (admins []Admin, err error) {
+	err = s.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(boltAdminsBucket).ForEach(func(k, v []byte) error {
+			var admin Admin
+			if err := json.Unmarshal(v, &admin); err != nil {
+				return err
+			}
+			admins = append(admins, admin)
+			return nil
+		})
+	})
+	return
+}
+
+// GetAdmin by user id
+func (s *BoltStorage) GetAdmin(ctx context.Context, userID int) (admin Admin, err error) {
+	err = s.db.View(func(tx *bbolt.Tx) error {
+		v := tx.Bucket(boltAdminsBucket).Get([]byte(strconv.Itoa(userID)))
+		if v == nil {
+			return ErrAdminNotFound
+		}
+		return json.Unmarshal(v, &admin)
+	})
+	return
+}
+
+// SaveAdmin add an admin or change its role
+func (s *BoltStorage) SaveAdmin(ctx context.Context, admin Admin) (err error) {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return putJSON(tx.Bucket(boltAdminsBucket), []byte(strconv.Itoa(admin.UserID)), admin)
+	})
+}
+
+// DeleteAdmin remove an admin
+func (s *BoltStorage) DeleteAdmin(ctx context.Context, userID int) (err error) {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(boltAdminsBucket).Delete([]byte(strconv.Itoa(userID)))
+	})
+}
+
+// GetBans all bans, including expired ones not deleted yet
+func (s *BoltStorage) GetBans(ctx context.Context) (bans []Ban, err error) {
+	err = s.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(boltBansBucket).ForEach(func(k, v []byte) error {
+			var ban Ban
+			if err := json.Unmarshal(v, &ban); err != nil {
+				return err
+			}
+			bans = append(bans, ban)
+			return nil
+		})
+	})
+	return
+}
+
+// GetBan by user id
+func (s *BoltStorage) GetBan(ctx context.Context, userID int) (ban Ban, err error) {
+	err = s.db.View(func(tx *bbolt.Tx) error {
+		v := tx.Bucket(boltBansBucket).Get([]byte(strconv.Itoa(userID)))
+		if v == nil {
+			return ErrBanNotFound
+		}
+		return json.Unmarshal(v, &ban)
+	})
+	return
+}
+
+// SaveBan ban a user or change the ban
+func (s *BoltStorage) SaveBan(ctx context.Context, ban Ban) (err error) {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return putJSON(tx.Bucket(boltBansBucket), []byte(strconv.Itoa(ban.UserID)), ban)
+	})
+}
+
+// DeleteBan lift the ban of a user
+func (s *BoltStorage) DeleteBan(ctx context.Context, userID int) (err error) {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(boltBansBucket).Delete([]byte(strconv.Itoa(userID)))
+	})
+}
+
+// InitWebhook save webhook unless one is saved already, returns the saved webhook
+func (s *BoltStorage) InitWebhook(ctx context.Context, webhook Webhook) (saved Webhook, err error) {
+	err = s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(boltSettingsBucket)
+		if v := b.Get(boltWebhookKey); v != nil {
+			return json.Unmarshal(v, &saved)
+		}
+		saved = webhook
+		return putJSON(b, boltWebhookKey, webhook)
+	})
+	return
+}
+
+// SaveInboxUpdate persist a received update, saving an update_id twice keeps the first
+func (s *BoltStorage) SaveInboxUpdate(ctx context.Context, update InboxUpdate) (err error) {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(boltInboxBucket)
+		key := boltInboxKey(update.UpdateID)
+		if b.Get(key) != nil {
+			return nil
+		}
+		return putJSON(b, key, update)
+	})
+}
+
+// ClaimInboxUpdates lease up to limit accepted updates nobody holds a lease on
+func (s *BoltStorage) ClaimInboxUpdates(ctx context.Context, now time.Time, lease time.Duration, limit int, newAccept func() InboxFilter) (updates []InboxUpdate, err error) {
+	err = s.db.Update(func(tx *bbolt.Tx) error {
+		updates = nil
+		scan := newInboxScan(now, newAccept)
+		b := tx.Bucket(boltInboxBucket)
+		// keys are big endian update ids, so the cursor walks them in order
+		cur := b.Cursor()
+		for k, v := cur.First(); k != nil && len(updates) < limit; k, v = cur.Next() {
+			var update InboxUpdate
+			if err := json.Unmarshal(v, &update); err != nil {
+				return err
+			}
+			if scan.take(update) {
+				update.ClaimedUntil = now.Add(lease)
+				updates = append(updates, update)
+			}
+		}
+		for _, update := range updates {
+			if err := putJSON(b, boltInboxKey(update.UpdateID), update); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return
+}
+
+// RenewInboxUpdate extend the lease of an update still leased until claimedUntil
+func (s *BoltStorage) RenewInboxUpdate(ctx context.Context, updateID int, claimedUntil, until time.Time) (ok bool, err error) {
+	err = s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(boltInboxBucket)
+		v := b.Get(boltInboxKey(updateID))
+		if v == nil {
+			return nil
+		}
+		var update InboxUpdate
+		if err := json.Unmarshal(v, &update); err != nil {
+			return err
+		}
+		if !update.ClaimedUntil.Equal(claimedUntil) {
+			return nil
+		}
+		ok = true
+		update.ClaimedUntil = until
+		return putJSON(b, boltInboxKey(updateID), update)
+	})
+	return
+}
+
+// AckInboxUpdate delete a processed update
+func (s *BoltStorage) AckInboxUpdate(ctx context.Context, updateID int) (err error) {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(boltInboxBucket).Delete(boltInboxKey(updateID))
+	})
+}
+
+func boltInboxKey(updateID int) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(updateID))
+	return key
+}
+
+// MarkUpdateProcessed remember updateID was handled, until expiresAt
+func (s *BoltStorage) MarkUpdateProcessed(ctx context.Context, updateID int, expiresAt time.Time) (err error) {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return putJSON(tx.Bucket(boltCountersBucket), []byte(processedUpdateKey(updateID)),
+			counter{Count: 1, ExpiresAt: expiresAt})
+	})
+}
+
+// IsUpdateProcessed report whether updateID was handled
+func (s *BoltStorage) IsUpdateProcessed(ctx context.Context, updateID int) (processed bool, err error) {
+	err = s.db.View(func(tx *bbolt.Tx) error {
+		processed = tx.Bucket(boltCountersBucket).Get([]byte(processedUpdateKey(updateID))) != nil
+		return nil
+	})
+	return
+}
+
+// SaveDeadLetter record an outgoing request that failed for good
+func (s *BoltStorage) SaveDeadLetter(ctx context.Context, letter DeadLetter) (err error) {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(boltLettersBucket)
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		letter.ID = strconv.FormatUint(seq, 10)
+		return putJSON(b, []byte(letter.ID), letter)
+	})
+}
+
+// ListDeadLetters newest dead letters first, at most limit
+func (s *BoltStorage) ListDeadLetters(ctx context.Context, limit int) (letters []DeadLetter, err error) {
+	err = s.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(boltLettersBucket).ForEach(func(k, v []byte) error {
+			var letter DeadLetter
+			if err := json.Unmarshal(v, &letter); err != nil {
+				return err
+			}
+			letters = append(letters, letter)
+			return nil
+		})
+	})
+	sortDeadLetters(letters)
+	if len(letters) > limit {
+		letters = letters[:limit]
+	}
+	return
+}
+
+// ClearDeadLetters delete all dead letters
+func (s *BoltStorage) ClearDeadLetters(ctx context.Context) (err error) {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		if err := tx.DeleteBucket(boltLettersBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucket(boltLettersBucket)
+		return err
+	})
+}
+
+// IncrCounter add one to counter key and return the new count
+func (s *BoltStorage) IncrCounter(ctx context.Context, key string, expiresAt time.Time) (count int, err error) {
+	err = s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(boltCountersBucket)
+		var c counter
+		if v := b.Get([]byte(key)); v != nil {
+			if err := json.Unmarshal(v, &c); err != nil {
+				return err
+			}
+		}
+		c.Count++
+		c.ExpiresAt = expiresAt
+		count = c.Count
+		return putJSON(b, []byte(key), c)
+	})
+	return
+}
+
+// DeleteExpiredCounters delete counters expired before now
+func (s *BoltStorage) DeleteExpiredCounters(ctx context.Context, now time.Time) (err error) {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(boltCountersBucket)
+		var keys [][]byte
+		err := b.ForEach(func(k, v []byte) error {
+			var c counter
+			if err := json.Unmarshal(v, &c); err != nil {
+				return err
+			}
+			if c.ExpiresAt.Before(now) {
+				keys = append(keys, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetContributor by user id
+func (s *BoltStorage) GetContributor(ctx context.Context, userID int) (contributor Contributor, err error) {
+	err = s.db.View(func(tx *bbolt.Tx) error {
+		v := tx.Bucket(boltContribsBucket).Get([]byte(strconv.Itoa(userID)))
+		if v == nil {
+			return ErrContributorNotFound
+		}
+		return json.Unmarshal(v, &contributor)
+	})
+	return
+}
+
+// SaveContributor save what is known about a contributor
+func (s *BoltStorage) SaveContributor(ctx context.Context, contributor Contributor) (err error) {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return putJSON(tx.Bucket(boltContribsBucket), []byte(strconv.Itoa(contributor.UserID)), contributor)
+	})
+}
+
+// EnqueuePublish add an approved message to the publish queue
+func (s *BoltStorage) EnqueuePublish(ctx context.Context, item QueueItem) (err error) {
+	if item.Position == 0 {
+		item.Position = item.EnqueuedAt.UnixNano()
+	}
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return putJSON(tx.Bucket(boltQueueBucket), []byte(item.ID), item)
+	})
+}
+
+// ListPublishQueue queued items in publish order
+func (s *BoltStorage) ListPublishQueue(ctx context.Context) (items []QueueItem, err error) {
+	err = s.db.View(func(tx *bbolt.Tx) (err error) {
+		items, err = boltQueue(tx)
+		return
+	})
+	return
+}
+
+// MovePublishQueueItem move queue item id to index of the queue
+func (s *BoltStorage) MovePublishQueueItem(ctx context.Context, id string, index int) (err error) {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		items, err := boltQueue(tx)
+		if err != nil {
+			return err
+		}
+		items, ok := moveQueueItem(items, id, index)
+		if !ok {
+			return ErrMessageNotFound
+		}
+		b := tx.Bucket(boltQueueBucket)
+		for _, item := range items {
+			if err = putJSON(b, []byte(item.ID), item); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ClaimNextPublish lease the first free item of the queue when nothing was published since slotStart
+func (s *BoltStorage) ClaimNextPublish(ctx context.Context, slotStart, now time.Time, lease time.Duration) (item QueueItem, ok bool, err error) {
+	err = s.db.Update(func(tx *bbolt.Tx) error {
+		var state publishState
+		settings := tx.Bucket(boltSettingsBucket)
+		if v := settings.Get(boltQueueStateKey); v != nil {
+			if err := json.Unmarshal(v, &state); err != nil {
+				return err
+			}
+		}
+		if !state.LastPublished.Before(slotStart) {
+			return nil
+		}
+		items, err := boltQueue(tx)
+		if err != nil {
+			return err
+		}
+		var found bool
+		if item, found = nextPublish(items, now); !found {
+			return nil
+		}
+		item.Attempts++
+		item.ClaimedUntil = now.Add(lease)
+		if err = putJSON(tx.Bucket(boltQueueBucket), []byte(item.ID), item); err != nil {
+			return err
+		}
+		if err = putJSON(settings, boltQueueStateKey, publishState{LastPublished: now}); err != nil {
+			return err
+		}
+		ok = true
+		return nil
+	})
+	return
+}
+
+// DequeuePublish remove a published or given up item from the queue
+func (s *BoltStorage) DequeuePublish(ctx context.Context, id string) (err error) {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(boltQueueBucket).Delete([]byte(id))
+	})
+}
+
+// boltQueue queue items sorted by position
+func boltQueue(tx *bbolt.Tx) (items []QueueItem, err error) {
+	err = tx.Bucket(boltQueueBucket).ForEach(func(k, v []byte) error {
+		var item QueueItem
+		if err := json.Unmarshal(v, &item); err != nil {
+			return err
+		}
+		items = append(items, item)
+		return nil
+	})
+	sortQueue(items)
+	return
+}
+
+// errStopIteration ends a bucket ForEach early without reporting failure
+var errStopIteration = errors.New("stop iteration")
+
+func putJSON(b *bbolt.Bucket, key []byte, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return b.Put(key, data)
+}
+
+// GetConversation what the bot waits for the user to send
+func (s *BoltStorage) GetConversation(ctx context.Context, userID int) (conversation Conversation, err error) {
+	err = s.db.View(func(tx *bbolt.Tx) error {
+		v := tx.Bucket(boltConvsBucket).Get([]byte(strconv.Itoa(userID)))
+		if v == nil {
+			return ErrConversationNotFound
+		}
+		return json.Unmarshal(v, &conversation)
+	})
+	return
+}
+
+// SaveConversation start or replace the conversation with the user
+func (s *BoltStorage) SaveConversation(ctx context.Context, conversation Conversation) (err error) {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return putJSON(tx.Bucket(boltConvsBucket), []byte(strconv.Itoa(conversation.UserID)), conversation)
+	})
+}
+
+// DeleteConversation end the conversation with the user
+func (s *BoltStorage) DeleteConversation(ctx context.Context, userID int) (err error) {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(boltConvsBucket).Delete([]byte(strconv.Itoa(userID)))
+	})
+}
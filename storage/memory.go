@@ -0,0 +1,497 @@
+package storage
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MemoryStorage storage kept in process memory, nothing survives a restart
+type MemoryStorage struct {
+	mu       sync.RWMutex
+	nextID   int
+	messages map[string]Message
+	settings *Settings
+	webhook  *Webhook
+	admins   map[int]Admin
+	bans     map[int]Ban
+	contribs map[int]Contributor
+	convs    map[int]Conversation
+	counters map[string]counter
+	inbox    map[int]InboxUpdate
+	letters  []DeadLetter
+	queue    map[string]QueueItem
+	state    publishState
+}
+
+// NewMemoryStorage return new in-memory storage object
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		messages: make(map[string]Message),
+		admins:   make(map[int]Admin),
+		bans:     make(map[int]Ban),
+		contribs: make(map[int]Contributor),
+		convs:    make(map[int]Conversation),
+		counters: make(map[string]counter),
+		inbox:    make(map[int]InboxUpdate),
+		queue:    make(map[string]QueueItem),
+	}
+}
+
+// Close close storage object
+func (s *MemoryStorage) Close() {}
+
+// CreateNewMessage save user new message, or overwrite the one saved for the same chat and message id
+func (s *MemoryStorage) CreateNewMessage(ctx context.Context, message Message) (id string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, msg := range s.messages {
+		if msg.ChatID == message.ChatID && msg.MessageID == message.MessageID {
+			id = msg.ID
+			break
+		}
+	}
+	if len(id) == 0 {
+		s.nextID++
+		id = strconv.Itoa(s.nextID)
+	}
+	message.ID = id
+	message.TimeStamp = message.Time.Unix()
+	s.messages[id] = message
+	return
+}
+
+// GetMessage by forwardID
+func (s *MemoryStorage) GetMessage(ctx context.Context, forwardID int) (originMsg Message, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, msg := range s.messages {
+		if msg.ForwardID == forwardID {
+			return msg, nil
+		}
+	}
+	err = ErrMessageNotFound
+	return
+}
+
+// GetLatestMessage the last message of the user that reached the review group
+func (s *MemoryStorage) GetLatestMessage(ctx context.Context, userID int) (message Message, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var messages []Message
+	for _, msg := range s.messages {
+		if msg.UserID == userID {
+			messages = append(messages, msg)
+		}
+	}
+	return latestMessage(messages)
+}
+
+// UpdateMessageStatus update message status
+func (s *MemoryStorage) UpdateMessageStatus(ctx context.Context, message Message) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	msg, ok := s.messages[message.ID]
+	if !ok {
+		return ErrMessageNotFound
+	}
+	msg.ForwardID = message.ForwardID
+	msg.Status = message.Status
+	s.messages[message.ID] = msg
+	return
+}
+
+// DeleteOldForwardMessages delete old messages
+func (s *MemoryStorage) DeleteOldForwardMessages(ctx context.Context) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deadline := time.Now().Add(-forwardedMessageTTL).Unix()
+	for id, msg := range s.messages {
+		if msg.TimeStamp < deadline && isPurgeable(msg.Status) {
+			delete(s.messages, id)
+		}
+	}
+	return
+}
+
+// SaveSettings save settings
+func (s *MemoryStorage) SaveSettings(ctx context.Context, settings Settings) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	settings = settings.Clone()
+	s.settings = &settings
+	return
+}
+
+// GetSettings get settings
+func (s *MemoryStorage) GetSettings(ctx context.Context) (settings Settings, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.settings == nil {
+		err = ErrSettingsNotFound
+		return
+	}
+	settings = s.settings.Clone()
+	return
+}
+
+// GetAdmins all admins
+func (s *MemoryStorage) GetAdmins(ctx context.Context) (admins []Admin, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, admin := range s.admins {
+		admins = append(admins, admin)
+	}
+	return
+}
+
+// GetAdmin by user id
+func (s *MemoryStorage) GetAdmin(ctx context.Context, userID int) (admin Admin, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	admin, ok := s.admins[userID]
+	if !ok {
+		err = ErrAdminNotFound
+	}
+	return
+}
+
+// SaveAdmin add an admin or change its role
+func (s *MemoryStorage) SaveAdmin(ctx context.Context, admin Admin) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.admins[admin.UserID] = admin
+	return
+}
+
+// DeleteAdmin remove an admin
+func (s *MemoryStorage) DeleteAdmin(ctx context.Context, userID int) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.admins, userID)
+	return
+}
+
+// GetBans all bans, including expired ones not deleted yet
+func (s *MemoryStorage) GetBans(ctx context.Context) (bans []Ban, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, ban := range s.bans {
+		bans = append(bans, ban)
+	}
+	return
+}
+
+// GetBan by user id
+func (s *MemoryStorage) GetBan(ctx context.Context, userID int) (ban Ban, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ban, ok := s.bans[userID]
+	if !ok {
+		err = ErrBanNotFound
+	}
+	return
+}
+
+// SaveBan ban a user or change the ban
+func (s *MemoryStorage) SaveBan(ctx context.Context, ban Ban) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.bans[ban.UserID] = ban
+	return
+}
+
+// DeleteBan lift the ban of a user
+func (s *MemoryStorage) DeleteBan(ctx context.Context, userID int) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.bans, userID)
+	return
+}
+
+// InitWebhook save webhook unless one is saved already, returns the saved webhook
+func (s *MemoryStorage) InitWebhook(ctx context.Context, webhook Webhook) (saved Webhook, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.webhook == nil {
+		s.webhook = &webhook
+	}
+	return *s.webhook, nil
+}
+
+// SaveInboxUpdate persist a received update, saving an update_id twice keeps the first
+func (s *MemoryStorage) SaveInboxUpdate(ctx context.Context, update InboxUpdate) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.inbox[update.UpdateID]; !ok {
+		s.inbox[update.UpdateID] = update
+	}
+	return
+}
+
+// ClaimInboxUpdates lease up to limit accepted updates nobody holds a lease on
+func (s *MemoryStorage) ClaimInboxUpdates(ctx context.Context, now time.Time, lease time.Duration, limit int, newAccept func() InboxFilter) (updates []InboxUpdate, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	inbox := make([]InboxUpdate, 0, len(s.inbox))
+	for _, update := range s.inbox {
+		inbox = append(inbox, update)
+	}
+	sortInbox(inbox)
+	scan := newInboxScan(now, newAccept)
+	for _, update := range inbox {
+		if len(updates) == limit {
+			break
+		}
+		if scan.take(update) {
+			updates = append(updates, update)
+		}
+	}
+	for i := range updates {
+		updates[i].ClaimedUntil = now.Add(lease)
+		s.inbox[updates[i].UpdateID] = updates[i]
+	}
+	return
+}
+
+// RenewInboxUpdate extend the lease of an update still leased until claimedUntil
+func (s *MemoryStorage) RenewInboxUpdate(ctx context.Context, updateID int, claimedUntil, until time.Time) (ok bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	update, ok := s.inbox[updateID]
+	if !ok || !update.ClaimedUntil.Equal(claimedUntil) {
+		return false, nil
+	}
+	update.ClaimedUntil = until
+	s.inbox[updateID] = update
+	return
+}
+
+// AckInboxUpdate delete a processed update
+func (s *MemoryStorage) AckInboxUpdate(ctx context.Context, updateID int) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.inbox, updateID)
+	return
+}
+
+// MarkUpdateProcessed remember updateID was handled, until expiresAt
+func (s *MemoryStorage) MarkUpdateProcessed(ctx context.Context, updateID int, expiresAt time.Time) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.counters[processedUpdateKey(updateID)] = counter{Count: 1, ExpiresAt: expiresAt}
+	return
+}
+
+// IsUpdateProcessed report whether updateID was handled
+func (s *MemoryStorage) IsUpdateProcessed(ctx context.Context, updateID int) (processed bool, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, processed = s.counters[processedUpdateKey(updateID)]
+	return
+}
+
+// SaveDeadLetter record an outgoing request that failed for good
+func (s *MemoryStorage) SaveDeadLetter(ctx context.Context, letter DeadLetter) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	letter.ID = strconv.Itoa(s.nextID)
+	s.letters = append(s.letters, letter)
+	return
+}
+
+// ListDeadLetters newest dead letters first, at most limit
+func (s *MemoryStorage) ListDeadLetters(ctx context.Context, limit int) (letters []DeadLetter, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	letters = append(letters, s.letters...)
+	sortDeadLetters(letters)
+	if len(letters) > limit {
+		letters = letters[:limit]
+	}
+	return
+}
+
+// ClearDeadLetters delete all dead letters
+func (s *MemoryStorage) ClearDeadLetters(ctx context.Context) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.letters = nil
+	return
+}
+
+// IncrCounter add one to counter key and return the new count
+func (s *MemoryStorage) IncrCounter(ctx context.Context, key string, expiresAt time.Time) (count int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.counters[key]
+	c.Count++
+	c.ExpiresAt = expiresAt
+	s.counters[key] = c
+	return c.Count, nil
+}
+
+// DeleteExpiredCounters delete counters expired before now
+func (s *MemoryStorage) DeleteExpiredCounters(ctx context.Context, now time.Time) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, c := range s.counters {
+		if c.ExpiresAt.Before(now) {
+			delete(s.counters, key)
+		}
+	}
+	return
+}
+
+// GetContributor by user id
+func (s *MemoryStorage) GetContributor(ctx context.Context, userID int) (contributor Contributor, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	contributor, ok := s.contribs[userID]
+	if !ok {
+		err = ErrContributorNotFound
+	}
+	return
+}
+
+// SaveContributor save what is known about a contributor
+func (s *MemoryStorage) SaveContributor(ctx context.Context, contributor Contributor) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.contribs[contributor.UserID] = contributor
+	return
+}
+
+// EnqueuePublish add an approved message to the publish queue
+func (s *MemoryStorage) EnqueuePublish(ctx context.Context, item QueueItem) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if item.Position == 0 {
+		item.Position = item.EnqueuedAt.UnixNano()
+	}
+	s.queue[item.ID] = item
+	return
+}
+
+// ListPublishQueue queued items in publish order
+func (s *MemoryStorage) ListPublishQueue(ctx context.Context) (items []QueueItem, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.sortedQueue(), nil
+}
+
+// MovePublishQueueItem move queue item id to index of the queue
+func (s *MemoryStorage) MovePublishQueueItem(ctx context.Context, id string, index int) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	items, ok := moveQueueItem(s.sortedQueue(), id, index)
+	if !ok {
+		return ErrMessageNotFound
+	}
+	for _, item := range items {
+		s.queue[item.ID] = item
+	}
+	return
+}
+
+// ClaimNextPublish lease the first free item of the queue when nothing was published since slotStart
+func (s *MemoryStorage) ClaimNextPublish(ctx context.Context, slotStart, now time.Time, lease time.Duration) (item QueueItem, ok bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.state.LastPublished.Before(slotStart) {
+		return
+	}
+	if item, ok = nextPublish(s.sortedQueue(), now); !ok {
+		return
+	}
+	item.Attempts++
+	item.ClaimedUntil = now.Add(lease)
+	s.queue[item.ID] = item
+	s.state.LastPublished = now
+	return
+}
+
+// DequeuePublish remove a published or given up item from the queue
+func (s *MemoryStorage) DequeuePublish(ctx context.Context, id string) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.queue, id)
+	return
+}
+
+func (s *MemoryStorage) sortedQueue() []QueueItem {
+	items := make([]QueueItem, 0, len(s.queue))
+	for _, item := range s.queue {
+		items = append(items, item)
+	}
+	sortQueue(items)
+	return items
+}
+
+var _ Storage = (*MemoryStorage)(nil)
+
+// GetConversation what the bot waits for the user to send
+func (s *MemoryStorage) GetConversation(ctx context.Context, userID int) (conversation Conversation, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	conversation, ok := s.convs[userID]
+	if !ok {
+		err = ErrConversationNotFound
+	}
+	return
+}
+
+// SaveConversation start or replace the conversation with the user
+func (s *MemoryStorage) SaveConversation(ctx context.Context, conversation Conversation) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.convs[conversation.UserID] = conversation
+	return
+}
+
+// DeleteConversation end the conversation with the user
+func (s *MemoryStorage) DeleteConversation(ctx context.Context, userID int) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.convs, userID)
+	return
+}
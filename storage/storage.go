@@ -3,7 +3,9 @@ package storage
 import (
 	"context"
 	"errors"
-	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
 	"time"
 
 	"cloud.google.com/go/firestore"
@@ -15,15 +17,386 @@ import (
 	"google.golang.org/grpc/status"
 )
 
-// Storage storage
-type Storage struct {
+// forwardedMessageTTL how long forwarded messages are kept for replies
+const forwardedMessageTTL = 3 * 24 * time.Hour
+
+// Message status, a submission moves from unread to forward once it reached the
+// review group, then reviewers approve, reject or ask for changes.
+// approved messages become published once posted to the channel, or publish_failed
+// when posting keeps failing.
+const (
+	StatusUnread           = "unread"
+	StatusForward          = "forward"
+	StatusApproved         = "approved"
+	StatusRejected         = "rejected"
+	StatusChangesRequested = "changes_requested"
+	StatusPublished        = "published"
+	StatusPublishFailed    = "publish_failed"
+)
+
+// purgeableStatus status of messages DeleteOldForwardMessages may delete,
+// approved messages are kept until they are published. unread ones never
+// reached the review group
+var purgeableStatus = []string{StatusUnread, StatusForward, StatusRejected, StatusChangesRequested, StatusPublished, StatusPublishFailed}
+
+func isPurgeable(status string) bool {
+	for _, s := range purgeableStatus {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// Admin roles, from least to most privileged.
+// reviewers handle submissions, editors also change settings and the publish queue,
+// owners also manage admins
+const (
+	RoleReviewer = "reviewer"
+	RoleEditor   = "editor"
+	RoleOwner    = "owner"
+)
+
+var (
+	// ErrMessageNotFound returned when no message matches the query
+	ErrMessageNotFound = errors.New("message not found")
+	// ErrAdminNotFound returned when the user is not an admin
+	ErrAdminNotFound = errors.New("admin not found")
+	// ErrBanNotFound returned when the user is not banned
+	ErrBanNotFound = errors.New("ban not found")
+	// ErrContributorNotFound returned when nothing is recorded about the user
+	ErrContributorNotFound = errors.New("contributor not found")
+	// ErrConversationNotFound returned when the bot is not waiting for input from the user
+	ErrConversationNotFound = errors.New("conversation not found")
+	// ErrSettingsNotFound returned when settings have not been saved yet
+	ErrSettingsNotFound = errors.New("settings not found")
+)
+
+// Storage persists contributed messages and bot settings
+type Storage interface {
+	// Close release resources held by the storage
+	Close()
+	// CreateNewMessage save user new message with its forward id and status in one write,
+	// return the id of the stored message. one saved before for the same chat and
+	// message id is overwritten
+	CreateNewMessage(ctx context.Context, message Message) (id string, err error)
+	// GetMessage by forwardID
+	GetMessage(ctx context.Context, forwardID int) (originMsg Message, err error)
+	// GetLatestMessage the last message of the user that reached the review group
+	GetLatestMessage(ctx context.Context, userID int) (message Message, err error)
+	// UpdateMessageStatus update forward id and status of message.ID
+	UpdateMessageStatus(ctx context.Context, message Message) (err error)
+	// DeleteOldForwardMessages delete reviewed or forwarded messages older than 3 days
+	DeleteOldForwardMessages(ctx context.Context) (err error)
+	// GetSettings get settings
+	GetSettings(ctx context.Context) (settings Settings, err error)
+	// SaveSettings save settings
+	SaveSettings(ctx context.Context, settings Settings) (err error)
+
+	// GetAdmins all admins
+	GetAdmins(ctx context.Context) (admins []Admin, err error)
+	// GetAdmin by user id
+	GetAdmin(ctx context.Context, userID int) (admin Admin, err error)
+	// SaveAdmin add an admin or change its role
+	SaveAdmin(ctx context.Context, admin Admin) (err error)
+	// DeleteAdmin remove an admin
+	DeleteAdmin(ctx context.Context, userID int) (err error)
+
+	// GetBans all bans, including expired ones not deleted yet
+	GetBans(ctx context.Context) (bans []Ban, err error)
+	// GetBan by user id
+	GetBan(ctx context.Context, userID int) (ban Ban, err error)
+	// SaveBan ban a user or change the ban
+	SaveBan(ctx context.Context, ban Ban) (err error)
+	// DeleteBan lift the ban of a user
+	DeleteBan(ctx context.Context, userID int) (err error)
+
+	// InitWebhook save webhook unless one is saved already, returns the saved webhook
+	InitWebhook(ctx context.Context, webhook Webhook) (saved Webhook, err error)
+
+	// SaveInboxUpdate persist a received update, saving an update_id twice keeps the first
+	SaveInboxUpdate(ctx context.Context, update InboxUpdate) (err error)
+	// ClaimInboxUpdates lease up to limit updates nobody holds a lease on until now+lease,
+	// in update_id order. a filter from newAccept is asked about each of them in that order,
+	// a new one for every scan since transactions may scan more than once. once an update
+	// of a chat is leased or not accepted, the later updates of that chat are left too.
+	// updates of a crashed worker come back once their lease expires
+	ClaimInboxUpdates(ctx context.Context, now time.Time, lease time.Duration, limit int, newAccept func() InboxFilter) (updates []InboxUpdate, err error)
+	// RenewInboxUpdate extend the lease of an update to until, if it is still leased until
+	// claimedUntil. ok is false when the update was acknowledged or claimed again
+	RenewInboxUpdate(ctx context.Context, updateID int, claimedUntil, until time.Time) (ok bool, err error)
+	// AckInboxUpdate delete a processed update
+	AckInboxUpdate(ctx context.Context, updateID int) (err error)
+
+	// MarkUpdateProcessed remember updateID was handled, until expiresAt
+	MarkUpdateProcessed(ctx context.Context, updateID int, expiresAt time.Time) (err error)
+	// IsUpdateProcessed report whether updateID was handled
+	IsUpdateProcessed(ctx context.Context, updateID int) (processed bool, err error)
+
+	// SaveDeadLetter record an outgoing request that failed for good
+	SaveDeadLetter(ctx context.Context, letter DeadLetter) (err error)
+	// ListDeadLetters newest dead letters first, at most limit
+	ListDeadLetters(ctx context.Context, limit int) (letters []DeadLetter, err error)
+	// ClearDeadLetters delete all dead letters
+	ClearDeadLetters(ctx context.Context) (err error)
+
+	// IncrCounter add one to counter key and return the new count,
+	// the counter may be deleted once expiresAt has passed
+	IncrCounter(ctx context.Context, key string, expiresAt time.Time) (count int, err error)
+	// DeleteExpiredCounters delete counters expired before now
+	DeleteExpiredCounters(ctx context.Context, now time.Time) (err error)
+
+	// GetContributor by user id
+	GetContributor(ctx context.Context, userID int) (contributor Contributor, err error)
+	// SaveContributor save what is known about a contributor
+	SaveContributor(ctx context.Context, contributor Contributor) (err error)
+
+	// GetConversation what the bot waits for the user to send
+	GetConversation(ctx context.Context, userID int) (conversation Conversation, err error)
+	// SaveConversation start or replace the conversation with the user
+	SaveConversation(ctx context.Context, conversation Conversation) (err error)
+	// DeleteConversation end the conversation with the user
+	DeleteConversation(ctx context.Context, userID int) (err error)
+
+	// EnqueuePublish add an approved message to the publish queue, a zero Position
+	// puts it at the end of the queue
+	EnqueuePublish(ctx context.Context, item QueueItem) (err error)
+	// ListPublishQueue queued items in publish order
+	ListPublishQueue(ctx context.Context) (items []QueueItem, err error)
+	// MovePublishQueueItem move queue item id to index of the queue
+	MovePublishQueueItem(ctx context.Context, id string, index int) (err error)
+	// ClaimNextPublish lease the first item nobody is publishing until now+lease when nothing
+	// was published since slotStart, recording now as the last publish time and counting
+	// the attempt. the item stays queued, so one whose publisher crashed comes back once
+	// the lease expires. ok is false when no item is free or the slot is already used
+	ClaimNextPublish(ctx context.Context, slotStart, now time.Time, lease time.Duration) (item QueueItem, ok bool, err error)
+	// DequeuePublish remove a published or given up item from the queue
+	DequeuePublish(ctx context.Context, id string) (err error)
+}
+
+// Admin a user allowed to manage the bot
+type Admin struct {
+	UserID int    `firestore:"uid"`
+	Name   string `firestore:"name"`
+	Role   string `firestore:"role"`
+}
+
+// Webhook where telegram delivers updates, shared by all instances
+type Webhook struct {
+	// Path random url path of the webhook
+	Path string `firestore:"path"`
+	// SecretToken telegram sends it in the X-Telegram-Bot-Api-Secret-Token header
+	SecretToken string `firestore:"secret_token"`
+}
+
+// InboxUpdate a received telegram update waiting to be processed
+type InboxUpdate struct {
+	UpdateID int `firestore:"update_id"`
+	// ChatID the chat the update belongs to, updates of one chat are handled in order
+	ChatID int64 `firestore:"chat_id"`
+	// Data the update as received from telegram
+	Data       []byte    `firestore:"data"`
+	ReceivedAt time.Time `firestore:"received_at"`
+	// ClaimedUntil lease of the worker processing the update, zero when unclaimed
+	ClaimedUntil time.Time `firestore:"claimed_until"`
+}
+
+// InboxFilter whether a claim takes the next unleased update of chatID
+type InboxFilter func(chatID int64) bool
+
+// inboxScan picks the updates one scan of the inbox claims, offered in update_id order.
+// a chat with an earlier update leased or not accepted gets nothing, so the updates of
+// a chat are never handled in parallel or out of order
+type inboxScan struct {
+	now     time.Time
+	accept  InboxFilter
+	blocked map[int64]bool
+}
+
+func newInboxScan(now time.Time, newAccept func() InboxFilter) *inboxScan {
+	return &inboxScan{now: now, accept: newAccept(), blocked: make(map[int64]bool)}
+}
+
+// take whether update is claimed
+func (scan *inboxScan) take(update InboxUpdate) bool {
+	if scan.blocked[update.ChatID] {
+		return false
+	}
+	if !update.ClaimedUntil.Before(scan.now) || !scan.accept(update.ChatID) {
+		scan.blocked[update.ChatID] = true
+		return false
+	}
+	return true
+}
+
+func sortInbox(updates []InboxUpdate) {
+	sort.Slice(updates, func(i, j int) bool {
+		return updates[i].UpdateID < updates[j].UpdateID
+	})
+}
+
+// DeadLetter an outgoing telegram request that still failed after retries
+type DeadLetter struct {
+	ID     string `firestore:"-"`
+	Method string `firestore:"method"`
+	ChatID int64  `firestore:"chatid"`
+	// Payload the request parameters as json
+	Payload  string    `firestore:"payload"`
+	Error    string    `firestore:"error"`
+	FailedAt time.Time `firestore:"failed_at"`
+}
+
+func sortDeadLetters(letters []DeadLetter) {
+	sort.SliceStable(letters, func(i, j int) bool {
+		return letters[i].FailedAt.After(letters[j].FailedAt)
+	})
+}
+
+// counter a count shared by all instances, e.g. for rate limits
+type counter struct {
+	Count     int       `firestore:"count"`
+	ExpiresAt time.Time `firestore:"expires_at"`
+}
+
+// processedUpdateKey processed updates are kept as counters,
+// so DeleteExpiredCounters also forgets them
+func processedUpdateKey(updateID int) string {
+	return "update:" + strconv.Itoa(updateID)
+}
+
+// Ban a contributor whose private messages are dropped
+type Ban struct {
+	UserID    int       `firestore:"uid"`
+	Name      string    `firestore:"name"`
+	Reason    string    `firestore:"reason"`
+	BannedBy  int       `firestore:"banned_by"`
+	CreatedAt time.Time `firestore:"created_at"`
+	// Ticket forward id of the submission the ban was issued on, 0 when banned by user id.
+	// in anonymous mode the review group sees only the ticket
+	Ticket int `firestore:"ticket"`
+	// Until zero means the ban never expires
+	Until time.Time `firestore:"until"`
+}
+
+// Active report whether the ban is still in effect at now
+func (b Ban) Active(now time.Time) bool {
+	return b.Until.IsZero() || now.Before(b.Until)
+}
+
+// Contributor delivery state of a user who sent submissions
+type Contributor struct {
+	UserID int `firestore:"uid"`
+	// Unreachable why messages to the user fail, e.g. the user blocked the bot.
+	// empty when the user is reachable
+	Unreachable      string    `firestore:"unreachable"`
+	UnreachableSince time.Time `firestore:"unreachable_since"`
+}
+
+// Conversation input the bot waits for from an admin, e.g. the new value of a setting
+type Conversation struct {
+	UserID int `firestore:"uid"`
+	// State what the next message of the user is for
+	State     string    `firestore:"state"`
+	ExpiresAt time.Time `firestore:"expires_at"`
+}
+
+// Expired the user took too long to answer
+func (c Conversation) Expired(now time.Time) bool {
+	return !now.Before(c.ExpiresAt)
+}
+
+// QueueItem an approved message waiting to be published, ID is the message ID
+type QueueItem struct {
+	ID         string    `firestore:"-"`
+	Username   string    `firestore:"name"`
+	ChatID     int64     `firestore:"chatid"`
+	MessageID  int       `firestore:"msgid"`
+	ForwardID  int       `firestore:"forwardid"`
+	Position   int64     `firestore:"position"`
+	EnqueuedAt time.Time `firestore:"enqueued_at"`
+	// LanguageCode of the contributor
+	LanguageCode string `firestore:"lang"`
+	// Attempts how many times publishing was tried
+	Attempts int `firestore:"attempts"`
+	// ClaimedUntil lease of the publisher, zero when nobody is publishing the item
+	ClaimedUntil time.Time `firestore:"claimed_until"`
+}
+
+// nextPublish the first item in publish order nobody holds a lease on
+func nextPublish(items []QueueItem, now time.Time) (item QueueItem, ok bool) {
+	for _, item := range items {
+		if item.ClaimedUntil.Before(now) {
+			return item, true
+		}
+	}
+	return
+}
+
+// publishState bookkeeping of the publish queue
+type publishState struct {
+	LastPublished time.Time `firestore:"last_published"`
+}
+
+func sortQueue(items []QueueItem) {
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Position < items[j].Position
+	})
+}
+
+// moveQueueItem move item id to index of items sorted by position, and
+// renumber positions. ok is false if id is not in items
+func moveQueueItem(items []QueueItem, id string, index int) (moved []QueueItem, ok bool) {
+	from := -1
+	for i, item := range items {
+		if item.ID == id {
+			from = i
+			break
+		}
+	}
+	if from < 0 {
+		return
+	}
+	if index < 0 {
+		index = 0
+	}
+	if index > len(items)-1 {
+		index = len(items) - 1
+	}
+	moved = make([]QueueItem, 0, len(items))
+	for i, item := range items {
+		if i != from {
+			moved = append(moved, item)
+		}
+	}
+	moved = append(moved[:index], append([]QueueItem{items[from]}, moved[index:]...)...)
+	for i := range moved {
+		moved[i].Position = int64(i + 1)
+	}
+	return moved, true
+}
+
+// operationTimeout longest a single firestore call, or transaction with its retries, may take
+const operationTimeout = 10 * time.Second
+
+// cleanupTimeout longest the cron cleanups may take
+const cleanupTimeout = time.Minute
+
+// FirestoreStorage storage backed by google cloud firestore
+type FirestoreStorage struct {
 	logwriter *stackdriverhook.StackdriverLoggingWriter
 	logger    zerolog.Logger
 	projectID string
+	client    *firestore.Client
 }
 
-// NewStorage return new storage object
-func NewStorage(projectID string) Storage {
+var _ Storage = (*FirestoreStorage)(nil)
+
+// NewStorage return new firestore storage object, its client is shared by all calls
+func NewStorage(projectID string) (*FirestoreStorage, error) {
+	client, err := firestore.NewClient(context.Background(), projectID)
+	if err != nil {
+		return nil, err
+	}
 	var logger zerolog.Logger
 	sw, err := stackdriverhook.NewStackdriverLoggingWriter(projectID, "storage", map[string]string{"from": "storage"})
 	if err != nil {
@@ -33,16 +406,22 @@ func NewStorage(projectID string) Storage {
 		logger = zerolog.New(sw).Level(zerolog.DebugLevel)
 	}
 
-	return Storage{
+	return &FirestoreStorage{
 		logwriter: sw,
 		logger:    logger,
 		projectID: projectID,
-	}
+		client:    client,
+	}, nil
 }
 
 // Close close storage object
-func (s Storage) Close() {
-	s.logwriter.Close()
+func (s *FirestoreStorage) Close() {
+	if err := s.client.Close(); err != nil {
+		s.logger.Error().Err(err).Msg("close firestore client failed")
+	}
+	if s.logwriter != nil {
+		s.logwriter.Close()
+	}
 }
 
 // Message an article record
@@ -56,35 +435,44 @@ type Message struct {
 	TimeStamp int64     `firestore:"timestamp"`
 	Status    string    `firestore:"status"`
 	ForwardID int       `firestore:"forwardid"`
+	// LanguageCode of the contributor, notices about the message are sent in it
+	LanguageCode string `firestore:"lang"`
 }
 
-// CreateNewMessage save user new message
-func (s Storage) CreateNewMessage(ctx context.Context, message Message) (docRef *firestore.DocumentRef, err error) {
-	client, err := firestore.NewClient(ctx, s.projectID)
-	if err != nil {
-		return
-	}
-	defer client.Close()
+// CreateNewMessage save user new message, a message saved before for the same chat and message id is overwritten
+func (s *FirestoreStorage) CreateNewMessage(ctx context.Context, message Message) (id string, err error) {
+	ctx, cancel := context.WithTimeout(ctx, operationTimeout)
+	defer cancel()
 
 	message.TimeStamp = message.Time.Unix()
-	docRef = client.Collection("messages").NewDoc()
-	_, err = docRef.Set(ctx, message)
+	messages := s.client.Collection("messages")
+	err = s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		docs, err := tx.Documents(messages.Where("chatid", "==", message.ChatID).
+			Where("msgid", "==", message.MessageID).Limit(1)).GetAll()
+		if err != nil {
+			return err
+		}
+		docRef := messages.NewDoc()
+		if len(docs) > 0 {
+			docRef = docs[0].Ref
+		}
+		id = docRef.ID
+		return tx.Set(docRef, message)
+	})
 	return
 }
 
 // GetMessage by forwardID
-func (s Storage) GetMessage(ctx context.Context, forwardID int) (originMsg Message, err error) {
-	client, err := firestore.NewClient(ctx, s.projectID)
-	if err != nil {
-		return
-	}
-	defer client.Close()
+func (s *FirestoreStorage) GetMessage(ctx context.Context, forwardID int) (originMsg Message, err error) {
+	ctx, cancel := context.WithTimeout(ctx, operationTimeout)
+	defer cancel()
 
-	docItor := client.Collection("messages").Where("forwardid", "==", forwardID).Limit(1).Documents(ctx)
+	docItor := s.client.Collection("messages").Where("forwardid", "==", forwardID).Limit(1).Documents(ctx)
 	for {
 		var doc *firestore.DocumentSnapshot
 		doc, err = docItor.Next()
 		if err == iterator.Done {
+			err = ErrMessageNotFound
 			break
 		}
 		if err != nil {
@@ -100,33 +488,60 @@ func (s Storage) GetMessage(ctx context.Context, forwardID int) (originMsg Messa
 	return
 }
 
-// UpdateMessageStatus update message status
-func (s Storage) UpdateMessageStatus(ctx context.Context, docRef *firestore.DocumentRef, message Message) (err error) {
-	client, err := firestore.NewClient(ctx, s.projectID)
+// GetLatestMessage the last message of the user that reached the review group
+func (s *FirestoreStorage) GetLatestMessage(ctx context.Context, userID int) (message Message, err error) {
+	ctx, cancel := context.WithTimeout(ctx, operationTimeout)
+	defer cancel()
+
+	// few messages per user are kept, picking the latest here needs no composite index
+	docs, err := s.client.Collection("messages").Where("uid", "==", userID).Documents(ctx).GetAll()
 	if err != nil {
 		return
 	}
-	defer client.Close()
+	var messages []Message
+	for _, doc := range docs {
+		var msg Message
+		if err = doc.DataTo(&msg); err != nil {
+			return
+		}
+		msg.ID = doc.Ref.ID
+		messages = append(messages, msg)
+	}
+	return latestMessage(messages)
+}
 
-	batch := client.Batch()
-	batch.Update(docRef, []firestore.Update{
+// latestMessage the newest of messages that reached the review group
+func latestMessage(messages []Message) (latest Message, err error) {
+	for _, msg := range messages {
+		if msg.ForwardID != 0 && msg.TimeStamp >= latest.TimeStamp {
+			latest = msg
+		}
+	}
+	if latest.ForwardID == 0 {
+		err = ErrMessageNotFound
+	}
+	return
+}
+
+// UpdateMessageStatus update message status
+func (s *FirestoreStorage) UpdateMessageStatus(ctx context.Context, message Message) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, operationTimeout)
+	defer cancel()
+
+	_, err = s.client.Collection("messages").Doc(message.ID).Update(ctx, []firestore.Update{
 		{Path: "forwardid", Value: message.ForwardID},
 		{Path: "status", Value: message.Status},
 	})
-	_, err = batch.Commit(ctx)
 	return
 }
 
 //DeleteOldForwardMessages delete old messages
-func (s Storage) DeleteOldForwardMessages(ctx context.Context) (err error) {
-	client, err := firestore.NewClient(ctx, s.projectID)
-	if err != nil {
-		return
-	}
-	defer client.Close()
+func (s *FirestoreStorage) DeleteOldForwardMessages(ctx context.Context) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, cleanupTimeout)
+	defer cancel()
 
 	var docRefs []*firestore.DocumentRef
-	docItor := client.Collection("messages").Where("timestamp", "<", time.Now().Add(-3*24*time.Hour).Unix()).Where("status", "==", "forward").Documents(ctx)
+	docItor := s.client.Collection("messages").Where("timestamp", "<", time.Now().Add(-forwardedMessageTTL).Unix()).Where("status", "in", purgeableStatus).Documents(ctx)
 	for {
 		var doc *firestore.DocumentSnapshot
 		doc, err = docItor.Next()
@@ -142,7 +557,7 @@ func (s Storage) DeleteOldForwardMessages(ctx context.Context) (err error) {
 		}
 	}
 
-	batch := client.Batch()
+	batch := s.client.Batch()
 	deleteItem := 0
 	for _, msg := range docRefs {
 		batch.Delete(msg)
@@ -163,26 +578,66 @@ type Settings struct {
 	Thanks                 string `firestore:"thanks"`
 	ForwardMessageToChatID int64  `firestore:"forward_message_to_chat_id"`
 	BotInfo                string `firestore:"bot_info"`
+	// PublishChannelID channel approved submissions are published to
+	PublishChannelID int64 `firestore:"publish_channel_id"`
+	// PublishSchedule when queued submissions are published: an interval like "3h",
+	// or daily slots like "09:00,18:00" with an optional time zone "09:00,18:00 Asia/Shanghai".
+	// empty publishes one every hour
+	PublishSchedule string `firestore:"publish_schedule"`
+	// RateLimitPerMinute most submissions a user may send per minute, 0 means no limit
+	RateLimitPerMinute int `firestore:"rate_limit_per_minute"`
+	// RateLimitPerDay most submissions a user may send per day, 0 means no limit
+	RateLimitPerDay int `firestore:"rate_limit_per_day"`
+	// Anonymous copy submissions to the review group instead of forwarding them,
+	// so the contributor's identity is not shown
+	Anonymous bool `firestore:"anonymous"`
+	// Texts translations of bot info, welcome and thanks words by language code like "zh"
+	Texts map[string]SettingsTexts `firestore:"texts"`
+	// ReviewLanguage language of tickets, review buttons and alerts in the review group,
+	// empty for english
+	ReviewLanguage string `firestore:"review_language"`
 }
 
-func (s Settings) String() string {
-	return fmt.Sprintf("bot info: %s\nwelcome words: %s\nthanks words: %s\nforward to: %d",
-		s.BotInfo,
-		s.WelcomeWords,
-		s.Thanks,
-		s.ForwardMessageToChatID,
-	)
+// SettingsTexts texts contributors see, in one language
+type SettingsTexts struct {
+	BotInfo      string `firestore:"bot_info"`
+	WelcomeWords string `firestore:"welcome_words"`
+	Thanks       string `firestore:"thanks"`
 }
 
-// SaveSettings save settings
-func (s Storage) SaveSettings(ctx context.Context, settings Settings) (err error) {
-	client, err := firestore.NewClient(ctx, s.projectID)
-	if err != nil {
-		return
+// Localized texts in language, untranslated ones are the default texts
+func (s Settings) Localized(language string) SettingsTexts {
+	texts := s.Texts[language]
+	if len(texts.BotInfo) == 0 {
+		texts.BotInfo = s.BotInfo
+	}
+	if len(texts.WelcomeWords) == 0 {
+		texts.WelcomeWords = s.WelcomeWords
 	}
-	defer client.Close()
+	if len(texts.Thanks) == 0 {
+		texts.Thanks = s.Thanks
+	}
+	return texts
+}
 
-	docRef := client.Doc("settings/setting")
+// Clone copy that shares no map with s
+func (s Settings) Clone() Settings {
+	if s.Texts != nil {
+		texts := make(map[string]SettingsTexts, len(s.Texts))
+		for language, t := range s.Texts {
+			texts[language] = t
+		}
+		s.Texts = texts
+	}
+	return s
+}
+
+// SaveSettings save settings
+func (s *FirestoreStorage) SaveSettings(ctx context.Context, settings Settings) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, operationTimeout)
+	defer cancel()
+
+	docRef := s.client.Doc("settings/setting")
 	docSnap, err := docRef.Get(ctx)
 	if err != nil {
 		if status.Code(err) != codes.NotFound {
@@ -199,61 +654,631 @@ func (s Storage) SaveSettings(ctx context.Context, settings Settings) (err error
 			s.logger.Error().Err(err).Send()
 			return
 		}
-		var batch = client.Batch()
-		var updates []firestore.Update
-		var needupdate bool = false
-		if oldSettings.BotInfo != settings.BotInfo {
-			updates = append(updates, firestore.Update{Path: "bot_info", Value: settings.BotInfo})
-			needupdate = true
+		if updates := settingsUpdates(oldSettings, settings); len(updates) != 0 {
+			if _, err = docRef.Update(ctx, updates); err != nil {
+				s.logger.Error().Err(err).Send()
+			}
 		}
-		if oldSettings.WelcomeWords != settings.WelcomeWords {
-			updates = append(updates, firestore.Update{Path: "welcome_words", Value: settings.WelcomeWords})
-			needupdate = true
+	} else {
+		err = ErrSettingsNotFound
+		s.logger.Error().Err(err).Send()
+	}
+	return
+}
+
+// settingsUpdates the fields that differ between old and new settings
+func settingsUpdates(old, new Settings) (updates []firestore.Update) {
+	if old.BotInfo != new.BotInfo {
+		updates = append(updates, firestore.Update{Path: "bot_info", Value: new.BotInfo})
+	}
+	if old.WelcomeWords != new.WelcomeWords {
+		updates = append(updates, firestore.Update{Path: "welcome_words", Value: new.WelcomeWords})
+	}
+	if old.Thanks != new.Thanks {
+		updates = append(updates, firestore.Update{Path: "thanks", Value: new.Thanks})
+	}
+	if old.ForwardMessageToChatID != new.ForwardMessageToChatID {
+		updates = append(updates, firestore.Update{Path: "forward_message_to_chat_id", Value: new.ForwardMessageToChatID})
+	}
+	if old.PublishChannelID != new.PublishChannelID {
+		updates = append(updates, firestore.Update{Path: "publish_channel_id", Value: new.PublishChannelID})
+	}
+	if old.PublishSchedule != new.PublishSchedule {
+		updates = append(updates, firestore.Update{Path: "publish_schedule", Value: new.PublishSchedule})
+	}
+	if old.RateLimitPerMinute != new.RateLimitPerMinute {
+		updates = append(updates, firestore.Update{Path: "rate_limit_per_minute", Value: new.RateLimitPerMinute})
+	}
+	if old.RateLimitPerDay != new.RateLimitPerDay {
+		updates = append(updates, firestore.Update{Path: "rate_limit_per_day", Value: new.RateLimitPerDay})
+	}
+	if old.Anonymous != new.Anonymous {
+		updates = append(updates, firestore.Update{Path: "anonymous", Value: new.Anonymous})
+	}
+	if !reflect.DeepEqual(old.Texts, new.Texts) {
+		updates = append(updates, firestore.Update{Path: "texts", Value: new.Texts})
+	}
+	if old.ReviewLanguage != new.ReviewLanguage {
+		updates = append(updates, firestore.Update{Path: "review_language", Value: new.ReviewLanguage})
+	}
+	return
+}
+
+//GetSettings get settings
+func (s *FirestoreStorage) GetSettings(ctx context.Context) (settings Settings, err error) {
+	ctx, cancel := context.WithTimeout(ctx, operationTimeout)
+	defer cancel()
+
+	docSnap, err := s.client.Doc("settings/setting").Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			err = ErrSettingsNotFound
 		}
-		if oldSettings.Thanks != settings.Thanks {
-			updates = append(updates, firestore.Update{Path: "thanks", Value: settings.Thanks})
-			needupdate = true
+		s.logger.Error().Err(err).Send()
+		return
+	}
+	if !docSnap.Exists() {
+		err = ErrSettingsNotFound
+		s.logger.Error().Err(err).Send()
+		return
+	}
+	err = docSnap.DataTo(&settings)
+	if err != nil {
+		s.logger.Error().Err(err).Send()
+	}
+	return
+}
+
+// EnqueuePublish add an approved message to the publish queue
+func (s *FirestoreStorage) EnqueuePublish(ctx context.Context, item QueueItem) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, operationTimeout)
+	defer cancel()
+
+	if item.Position == 0 {
+		item.Position = item.EnqueuedAt.UnixNano()
+	}
+	_, err = s.client.Collection("publish_queue").Doc(item.ID).Set(ctx, item)
+	return
+}
+
+// ListPublishQueue queued items in publish order
+func (s *FirestoreStorage) ListPublishQueue(ctx context.Context) (items []QueueItem, err error) {
+	ctx, cancel := context.WithTimeout(ctx, operationTimeout)
+	defer cancel()
+
+	docs, err := s.client.Collection("publish_queue").OrderBy("position", firestore.Asc).Documents(ctx).GetAll()
+	if err != nil {
+		s.logger.Error().Err(err).Send()
+		return
+	}
+	for _, doc := range docs {
+		var item QueueItem
+		if err = doc.DataTo(&item); err != nil {
+			s.logger.Error().Err(err).Send()
+			return
+		}
+		item.ID = doc.Ref.ID
+		items = append(items, item)
+	}
+	return
+}
+
+// MovePublishQueueItem move queue item id to index of the queue
+func (s *FirestoreStorage) MovePublishQueueItem(ctx context.Context, id string, index int) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, operationTimeout)
+	defer cancel()
+
+	queue := s.client.Collection("publish_queue")
+	return s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		docs, err := tx.Documents(queue.OrderBy("position", firestore.Asc)).GetAll()
+		if err != nil {
+			return err
 		}
-		if oldSettings.ForwardMessageToChatID != settings.ForwardMessageToChatID {
-			updates = append(updates, firestore.Update{Path: "forward_message_to_chat_id", Value: settings.ForwardMessageToChatID})
-			needupdate = true
+		items := make([]QueueItem, len(docs))
+		for i, doc := range docs {
+			if err = doc.DataTo(&items[i]); err != nil {
+				return err
+			}
+			items[i].ID = doc.Ref.ID
 		}
-		if needupdate {
-			batch.Update(docRef, updates)
-			_, err = batch.Commit(ctx)
-			if err != nil {
-				s.logger.Error().Err(err).Send()
+		items, ok := moveQueueItem(items, id, index)
+		if !ok {
+			return ErrMessageNotFound
+		}
+		for _, item := range items {
+			if err = tx.Update(queue.Doc(item.ID), []firestore.Update{{Path: "position", Value: item.Position}}); err != nil {
+				return err
 			}
 		}
-	} else {
-		err = errors.New("settings not found")
+		return nil
+	})
+}
+
+// ClaimNextPublish lease the first free item of the queue when nothing was published since slotStart
+func (s *FirestoreStorage) ClaimNextPublish(ctx context.Context, slotStart, now time.Time, lease time.Duration) (item QueueItem, ok bool, err error) {
+	ctx, cancel := context.WithTimeout(ctx, operationTimeout)
+	defer cancel()
+
+	stateRef := s.client.Doc("settings/publish_queue")
+	queue := s.client.Collection("publish_queue")
+	err = s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		ok = false
+		var state publishState
+		docSnap, err := tx.Get(stateRef)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		if err == nil {
+			if err = docSnap.DataTo(&state); err != nil {
+				return err
+			}
+		}
+		if !state.LastPublished.Before(slotStart) {
+			return nil
+		}
+		docs, err := tx.Documents(queue.OrderBy("position", firestore.Asc)).GetAll()
+		if err != nil {
+			return err
+		}
+		items := make([]QueueItem, len(docs))
+		for i, doc := range docs {
+			if err = doc.DataTo(&items[i]); err != nil {
+				return err
+			}
+			items[i].ID = doc.Ref.ID
+		}
+		if item, ok = nextPublish(items, now); !ok {
+			return nil
+		}
+		item.Attempts++
+		item.ClaimedUntil = now.Add(lease)
+		err = tx.Update(queue.Doc(item.ID), []firestore.Update{
+			{Path: "attempts", Value: item.Attempts},
+			{Path: "claimed_until", Value: item.ClaimedUntil},
+		})
+		if err != nil {
+			return err
+		}
+		return tx.Set(stateRef, publishState{LastPublished: now})
+	})
+	if err != nil {
 		s.logger.Error().Err(err).Send()
 	}
 	return
 }
 
-//GetSettings get settings
-func (s Storage) GetSettings(ctx context.Context) (settings Settings, err error) {
-	client, err := firestore.NewClient(ctx, s.projectID)
+// DequeuePublish remove a published or given up item from the queue
+func (s *FirestoreStorage) DequeuePublish(ctx context.Context, id string) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, operationTimeout)
+	defer cancel()
+
+	_, err = s.client.Collection("publish_queue").Doc(id).Delete(ctx)
+	return
+}
+
+// GetAdmins all admins
+func (s *FirestoreStorage) GetAdmins(ctx context.Context) (admins []Admin, err error) {
+	ctx, cancel := context.WithTimeout(ctx, operationTimeout)
+	defer cancel()
+
+	docs, err := s.client.Collection("admins").Documents(ctx).GetAll()
 	if err != nil {
 		s.logger.Error().Err(err).Send()
 		return
 	}
-	defer client.Close()
+	for _, doc := range docs {
+		var admin Admin
+		if err = doc.DataTo(&admin); err != nil {
+			s.logger.Error().Err(err).Send()
+			return
+		}
+		admins = append(admins, admin)
+	}
+	return
+}
+
+// GetAdmin by user id
+func (s *FirestoreStorage) GetAdmin(ctx context.Context, userID int) (admin Admin, err error) {
+	ctx, cancel := context.WithTimeout(ctx, operationTimeout)
+	defer cancel()
+
+	docSnap, err := s.client.Collection("admins").Doc(strconv.Itoa(userID)).Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			err = ErrAdminNotFound
+		}
+		return
+	}
+	err = docSnap.DataTo(&admin)
+	return
+}
+
+// SaveAdmin add an admin or change its role
+func (s *FirestoreStorage) SaveAdmin(ctx context.Context, admin Admin) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, operationTimeout)
+	defer cancel()
+
+	_, err = s.client.Collection("admins").Doc(strconv.Itoa(admin.UserID)).Set(ctx, admin)
+	return
+}
 
-	docSnap, err := client.Doc("settings/setting").Get(ctx)
+// DeleteAdmin remove an admin
+func (s *FirestoreStorage) DeleteAdmin(ctx context.Context, userID int) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, operationTimeout)
+	defer cancel()
+
+	_, err = s.client.Collection("admins").Doc(strconv.Itoa(userID)).Delete(ctx)
+	return
+}
+
+// GetBans all bans, including expired ones not deleted yet
+func (s *FirestoreStorage) GetBans(ctx context.Context) (bans []Ban, err error) {
+	ctx, cancel := context.WithTimeout(ctx, operationTimeout)
+	defer cancel()
+
+	docs, err := s.client.Collection("bans").Documents(ctx).GetAll()
 	if err != nil {
 		s.logger.Error().Err(err).Send()
 		return
 	}
-	if !docSnap.Exists() {
-		err = errors.New("settings not found")
+	for _, doc := range docs {
+		var ban Ban
+		if err = doc.DataTo(&ban); err != nil {
+			s.logger.Error().Err(err).Send()
+			return
+		}
+		bans = append(bans, ban)
+	}
+	return
+}
+
+// GetBan by user id
+func (s *FirestoreStorage) GetBan(ctx context.Context, userID int) (ban Ban, err error) {
+	ctx, cancel := context.WithTimeout(ctx, operationTimeout)
+	defer cancel()
+
+	docSnap, err := s.client.Collection("bans").Doc(strconv.Itoa(userID)).Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			err = ErrBanNotFound
+		}
+		return
+	}
+	err = docSnap.DataTo(&ban)
+	return
+}
+
+// SaveBan ban a user or change the ban
+func (s *FirestoreStorage) SaveBan(ctx context.Context, ban Ban) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, operationTimeout)
+	defer cancel()
+
+	_, err = s.client.Collection("bans").Doc(strconv.Itoa(ban.UserID)).Set(ctx, ban)
+	return
+}
+
+// DeleteBan lift the ban of a user
+func (s *FirestoreStorage) DeleteBan(ctx context.Context, userID int) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, operationTimeout)
+	defer cancel()
+
+	_, err = s.client.Collection("bans").Doc(strconv.Itoa(userID)).Delete(ctx)
+	return
+}
+
+// IncrCounter add one to counter key and return the new count
+func (s *FirestoreStorage) IncrCounter(ctx context.Context, key string, expiresAt time.Time) (count int, err error) {
+	ctx, cancel := context.WithTimeout(ctx, operationTimeout)
+	defer cancel()
+
+	docRef := s.client.Collection("counters").Doc(key)
+	err = s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		var c counter
+		docSnap, err := tx.Get(docRef)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		if err == nil {
+			if err = docSnap.DataTo(&c); err != nil {
+				return err
+			}
+		}
+		c.Count++
+		c.ExpiresAt = expiresAt
+		count = c.Count
+		return tx.Set(docRef, c)
+	})
+	return
+}
+
+// DeleteExpiredCounters delete counters expired before now
+func (s *FirestoreStorage) DeleteExpiredCounters(ctx context.Context, now time.Time) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, cleanupTimeout)
+	defer cancel()
+
+	docs, err := s.client.Collection("counters").Where("expires_at", "<", now).Documents(ctx).GetAll()
+	if err != nil {
 		s.logger.Error().Err(err).Send()
 		return
 	}
-	err = docSnap.DataTo(&settings)
+	// a batch holds at most 500 writes
+	for len(docs) > 0 {
+		n := len(docs)
+		if n > 500 {
+			n = 500
+		}
+		batch := s.client.Batch()
+		for _, doc := range docs[:n] {
+			batch.Delete(doc.Ref)
+		}
+		if _, err = batch.Commit(ctx); err != nil {
+			s.logger.Error().Err(err).Send()
+			return
+		}
+		docs = docs[n:]
+	}
+	return
+}
+
+// InitWebhook save webhook unless one is saved already, returns the saved webhook
+func (s *FirestoreStorage) InitWebhook(ctx context.Context, webhook Webhook) (saved Webhook, err error) {
+	ctx, cancel := context.WithTimeout(ctx, operationTimeout)
+	defer cancel()
+
+	docRef := s.client.Doc("settings/webhook")
+	if _, err = docRef.Create(ctx, webhook); err == nil {
+		return webhook, nil
+	}
+	if status.Code(err) != codes.AlreadyExists {
+		s.logger.Error().Err(err).Send()
+		return
+	}
+	docSnap, err := docRef.Get(ctx)
+	if err != nil {
+		s.logger.Error().Err(err).Send()
+		return
+	}
+	err = docSnap.DataTo(&saved)
+	return
+}
+
+// SaveInboxUpdate persist a received update, saving an update_id twice keeps the first
+func (s *FirestoreStorage) SaveInboxUpdate(ctx context.Context, update InboxUpdate) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, operationTimeout)
+	defer cancel()
+
+	_, err = s.client.Collection("inbox").Doc(strconv.Itoa(update.UpdateID)).Create(ctx, update)
+	if status.Code(err) == codes.AlreadyExists {
+		err = nil
+	}
+	return
+}
+
+// ClaimInboxUpdates lease up to limit accepted updates nobody holds a lease on
+func (s *FirestoreStorage) ClaimInboxUpdates(ctx context.Context, now time.Time, lease time.Duration, limit int, newAccept func() InboxFilter) (updates []InboxUpdate, err error) {
+	ctx, cancel := context.WithTimeout(ctx, operationTimeout)
+	defer cancel()
+
+	// ordered by the numeric update_id, leases are checked here because firestore
+	// can not order by one field while filtering on a range of another
+	query := s.client.Collection("inbox").OrderBy("update_id", firestore.Asc)
+	err = s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		updates = nil
+		var refs []*firestore.DocumentRef
+		scan := newInboxScan(now, newAccept)
+		docItor := tx.Documents(query)
+		defer docItor.Stop()
+		for len(updates) < limit {
+			doc, err := docItor.Next()
+			if err == iterator.Done {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			var update InboxUpdate
+			if err = doc.DataTo(&update); err != nil {
+				return err
+			}
+			if scan.take(update) {
+				updates = append(updates, update)
+				refs = append(refs, doc.Ref)
+			}
+		}
+		// firestore keeps microseconds, RenewInboxUpdate compares with what it reads back
+		claimedUntil := now.Add(lease).Truncate(time.Microsecond)
+		for i := range updates {
+			updates[i].ClaimedUntil = claimedUntil
+			if err := tx.Update(refs[i], []firestore.Update{{Path: "claimed_until", Value: updates[i].ClaimedUntil}}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 	if err != nil {
 		s.logger.Error().Err(err).Send()
+		return
+	}
+	sortInbox(updates)
+	return
+}
+
+// RenewInboxUpdate extend the lease of an update still leased until claimedUntil
+func (s *FirestoreStorage) RenewInboxUpdate(ctx context.Context, updateID int, claimedUntil, until time.Time) (ok bool, err error) {
+	ctx, cancel := context.WithTimeout(ctx, operationTimeout)
+	defer cancel()
+
+	docRef := s.client.Collection("inbox").Doc(strconv.Itoa(updateID))
+	err = s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		ok = false
+		doc, err := tx.Get(docRef)
+		if status.Code(err) == codes.NotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var update InboxUpdate
+		if err = doc.DataTo(&update); err != nil {
+			return err
+		}
+		if !update.ClaimedUntil.Equal(claimedUntil) {
+			return nil
+		}
+		ok = true
+		return tx.Update(docRef, []firestore.Update{{Path: "claimed_until", Value: until.Truncate(time.Microsecond)}})
+	})
+	return
+}
+
+// AckInboxUpdate delete a processed update
+func (s *FirestoreStorage) AckInboxUpdate(ctx context.Context, updateID int) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, operationTimeout)
+	defer cancel()
+
+	_, err = s.client.Collection("inbox").Doc(strconv.Itoa(updateID)).Delete(ctx)
+	return
+}
+
+// MarkUpdateProcessed remember updateID was handled, until expiresAt
+func (s *FirestoreStorage) MarkUpdateProcessed(ctx context.Context, updateID int, expiresAt time.Time) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, operationTimeout)
+	defer cancel()
+
+	_, err = s.client.Collection("counters").Doc(processedUpdateKey(updateID)).Set(ctx, counter{Count: 1, ExpiresAt: expiresAt})
+	return
+}
+
+// IsUpdateProcessed report whether updateID was handled
+func (s *FirestoreStorage) IsUpdateProcessed(ctx context.Context, updateID int) (processed bool, err error) {
+	ctx, cancel := context.WithTimeout(ctx, operationTimeout)
+	defer cancel()
+
+	_, err = s.client.Collection("counters").Doc(processedUpdateKey(updateID)).Get(ctx)
+	if err == nil {
+		return true, nil
+	}
+	if status.Code(err) == codes.NotFound {
+		err = nil
 	}
 	return
 }
+
+// SaveDeadLetter record an outgoing request that failed for good
+func (s *FirestoreStorage) SaveDeadLetter(ctx context.Context, letter DeadLetter) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, operationTimeout)
+	defer cancel()
+
+	_, _, err = s.client.Collection("dead_letters").Add(ctx, letter)
+	return
+}
+
+// ListDeadLetters newest dead letters first, at most limit
+func (s *FirestoreStorage) ListDeadLetters(ctx context.Context, limit int) (letters []DeadLetter, err error) {
+	ctx, cancel := context.WithTimeout(ctx, operationTimeout)
+	defer cancel()
+
+	docs, err := s.client.Collection("dead_letters").OrderBy("failed_at", firestore.Desc).Limit(limit).Documents(ctx).GetAll()
+	if err != nil {
+		s.logger.Error().Err(err).Send()
+		return
+	}
+	for _, doc := range docs {
+		var letter DeadLetter
+		if err = doc.DataTo(&letter); err != nil {
+			s.logger.Error().Err(err).Send()
+			return
+		}
+		letter.ID = doc.Ref.ID
+		letters = append(letters, letter)
+	}
+	return
+}
+
+// ClearDeadLetters delete all dead letters
+func (s *FirestoreStorage) ClearDeadLetters(ctx context.Context) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, operationTimeout)
+	defer cancel()
+
+	refs, err := s.client.Collection("dead_letters").DocumentRefs(ctx).GetAll()
+	if err != nil {
+		s.logger.Error().Err(err).Send()
+		return
+	}
+	// a batch holds at most 500 writes
+	for len(refs) > 0 {
+		n := len(refs)
+		if n > 500 {
+			n = 500
+		}
+		batch := s.client.Batch()
+		for _, ref := range refs[:n] {
+			batch.Delete(ref)
+		}
+		if _, err = batch.Commit(ctx); err != nil {
+			s.logger.Error().Err(err).Send()
+			return
+		}
+		refs = refs[n:]
+	}
+	return
+}
+
+// GetContributor by user id
+func (s *FirestoreStorage) GetContributor(ctx context.Context, userID int) (contributor Contributor, err error) {
+	ctx, cancel := context.WithTimeout(ctx, operationTimeout)
+	defer cancel()
+
+	docSnap, err := s.client.Collection("contributors").Doc(strconv.Itoa(userID)).Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			err = ErrContributorNotFound
+		}
+		return
+	}
+	err = docSnap.DataTo(&contributor)
+	return
+}
+
+// SaveContributor save what is known about a contributor
+func (s *FirestoreStorage) SaveContributor(ctx context.Context, contributor Contributor) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, operationTimeout)
+	defer cancel()
+
+	_, err = s.client.Collection("contributors").Doc(strconv.Itoa(contributor.UserID)).Set(ctx, contributor)
+	return
+}
+
+// GetConversation what the bot waits for the user to send
+func (s *FirestoreStorage) GetConversation(ctx context.Context, userID int) (conversation Conversation, err error) {
+	ctx, cancel := context.WithTimeout(ctx, operationTimeout)
+	defer cancel()
+
+	docSnap, err := s.client.Collection("conversations").Doc(strconv.Itoa(userID)).Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			err = ErrConversationNotFound
+		}
+		return
+	}
+	err = docSnap.DataTo(&conversation)
+	return
+}
+
+// SaveConversation start or replace the conversation with the user
+func (s *FirestoreStorage) SaveConversation(ctx context.Context, conversation Conversation) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, operationTimeout)
+	defer cancel()
+
+	_, err = s.client.Collection("conversations").Doc(strconv.Itoa(conversation.UserID)).Set(ctx, conversation)
+	return
+}
+
+// DeleteConversation end the conversation with the user
+func (s *FirestoreStorage) DeleteConversation(ctx context.Context, userID int) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, operationTimeout)
+	defer cancel()
+
+	_, err = s.client.Collection("conversations").Doc(strconv.Itoa(userID)).Delete(ctx)
+	return
+}
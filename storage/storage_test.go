@@ -0,0 +1,368 @@
+package storage
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// storages every Storage which runs without a server, fresh for each test
+var storages = []struct {
+	name string
+	open func(t *testing.T) Storage
+}{
+	{"memory", func(t *testing.T) Storage {
+		return NewMemoryStorage()
+	}},
+	{"bolt", func(t *testing.T) Storage {
+		dir, err := ioutil.TempDir("", "storage")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { os.RemoveAll(dir) })
+		s, err := NewBoltStorage(filepath.Join(dir, "bot.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}},
+}
+
+// runContract run test against every storage in storages
+func runContract(t *testing.T, test func(t *testing.T, s Storage)) {
+	for _, impl := range storages {
+		open := impl.open
+		t.Run(impl.name, func(t *testing.T) {
+			s := open(t)
+			defer s.Close()
+			test(t, s)
+		})
+	}
+}
+
+func TestCreateNewMessageUpsert(t *testing.T) {
+	runContract(t, func(t *testing.T, s Storage) {
+		ctx := context.Background()
+		msg := Message{UserID: 1, ChatID: 1, MessageID: 10, Time: time.Now(), Status: StatusUnread}
+		id, err := s.CreateNewMessage(ctx, msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg.ForwardID, msg.Status = 100, StatusForward
+		again, err := s.CreateNewMessage(ctx, msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if again != id {
+			t.Errorf("same chat and message id saved as %q and %q", id, again)
+		}
+		got, err := s.GetMessage(ctx, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.ID != id || got.Status != StatusForward {
+			t.Errorf("GetMessage = %+v, want the overwritten message %q", got, id)
+		}
+
+		other, err := s.CreateNewMessage(ctx, Message{UserID: 1, ChatID: 1, MessageID: 11, Time: time.Now()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if other == id {
+			t.Errorf("another message id overwrote %q", id)
+		}
+	})
+}
+
+func TestGetMessageNotFound(t *testing.T) {
+	runContract(t, func(t *testing.T, s Storage) {
+		if _, err := s.GetMessage(context.Background(), 404); err != ErrMessageNotFound {
+			t.Errorf("GetMessage of unknown forward id: err = %v, want ErrMessageNotFound", err)
+		}
+	})
+}
+
+func TestDeleteOldForwardMessages(t *testing.T) {
+	old := time.Now().Add(-forwardedMessageTTL - time.Hour)
+	tests := []struct {
+		status string
+		time   time.Time
+		kept   bool
+	}{
+		{StatusForward, old, false},
+		{StatusRejected, old, false},
+		{StatusChangesRequested, old, false},
+		{StatusPublished, old, false},
+		{StatusPublishFailed, old, false},
+		{StatusApproved, old, true},
+		{StatusForward, time.Now(), true},
+		{StatusRejected, time.Now(), true},
+	}
+	runContract(t, func(t *testing.T, s Storage) {
+		ctx := context.Background()
+		for i, tt := range tests {
+			_, err := s.CreateNewMessage(ctx, Message{ChatID: 1, MessageID: i + 1, ForwardID: i + 1, Time: tt.time, Status: tt.status})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := s.DeleteOldForwardMessages(ctx); err != nil {
+			t.Fatal(err)
+		}
+		for i, tt := range tests {
+			_, err := s.GetMessage(ctx, i+1)
+			if kept := err == nil; kept != tt.kept || (err != nil && err != ErrMessageNotFound) {
+				t.Errorf("%s message from %s: kept = %v (err %v), want %v", tt.status, tt.time.Format(time.RFC3339), kept, err, tt.kept)
+			}
+		}
+	})
+}
+
+func TestGetSettingsNotFound(t *testing.T) {
+	runContract(t, func(t *testing.T, s Storage) {
+		ctx := context.Background()
+		if _, err := s.GetSettings(ctx); err != ErrSettingsNotFound {
+			t.Fatalf("GetSettings before SaveSettings: err = %v, want ErrSettingsNotFound", err)
+		}
+		if err := s.SaveSettings(ctx, Settings{ForwardMessageToChatID: -1}); err != nil {
+			t.Fatal(err)
+		}
+		settings, err := s.GetSettings(ctx)
+		if err != nil || settings.ForwardMessageToChatID != -1 {
+			t.Errorf("GetSettings = %+v, %v", settings, err)
+		}
+	})
+}
+
+// TestSettingsUpdates every settings field is written by FirestoreStorage.SaveSettings,
+// a field missing there reverts on the next reload
+func TestSettingsUpdates(t *testing.T) {
+	typ := reflect.TypeOf(Settings{})
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		var settings Settings
+		value := reflect.ValueOf(&settings).Elem().Field(i)
+		switch value.Kind() {
+		case reflect.String:
+			value.SetString("changed")
+		case reflect.Int, reflect.Int64:
+			value.SetInt(1)
+		case reflect.Bool:
+			value.SetBool(true)
+		case reflect.Map:
+			value.Set(reflect.MakeMap(field.Type))
+			value.SetMapIndex(reflect.ValueOf("zh"), reflect.Zero(field.Type.Elem()))
+		default:
+			t.Fatalf("%s: no test value for %s", field.Name, field.Type)
+		}
+		path := strings.Split(field.Tag.Get("firestore"), ",")[0]
+		updates := settingsUpdates(Settings{}, settings)
+		if len(updates) != 1 || updates[0].Path != path || !reflect.DeepEqual(updates[0].Value, value.Interface()) {
+			t.Errorf("%s changed: updates = %+v, want %s", field.Name, updates, path)
+		}
+	}
+	if updates := settingsUpdates(Settings{Anonymous: true}, Settings{Anonymous: true}); len(updates) != 0 {
+		t.Errorf("unchanged settings: updates = %+v", updates)
+	}
+}
+
+// acceptAll an InboxFilter factory taking every update
+func acceptAll() InboxFilter {
+	return func(chatID int64) bool { return true }
+}
+
+// saveInbox save updates of chats, update_id i+1 belongs to chats[i]
+func saveInbox(t *testing.T, s Storage, chats ...int64) {
+	for i, chatID := range chats {
+		err := s.SaveInboxUpdate(context.Background(), InboxUpdate{UpdateID: i + 1, ChatID: chatID, ReceivedAt: time.Now()})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func updateIDs(updates []InboxUpdate) (ids []int) {
+	for _, update := range updates {
+		ids = append(ids, update.UpdateID)
+	}
+	return
+}
+
+func TestClaimInboxUpdatesChatOrder(t *testing.T) {
+	runContract(t, func(t *testing.T, s Storage) {
+		ctx := context.Background()
+		now := time.Now()
+		saveInbox(t, s, 1, 1, 2, 1, 2)
+
+		claimed, err := s.ClaimInboxUpdates(ctx, now, time.Minute, 1, acceptAll)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ids := updateIDs(claimed); !reflect.DeepEqual(ids, []int{1}) {
+			t.Fatalf("first claim = %v, want [1]", ids)
+		}
+		// update 1 is still leased, so the later updates of chat 1 wait for it
+		claimed, err = s.ClaimInboxUpdates(ctx, now, time.Minute, 10, acceptAll)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ids := updateIDs(claimed); !reflect.DeepEqual(ids, []int{3, 5}) {
+			t.Fatalf("claim while chat 1 is leased = %v, want [3 5]", ids)
+		}
+	})
+}
+
+func TestClaimInboxUpdatesNotAccepted(t *testing.T) {
+	runContract(t, func(t *testing.T, s Storage) {
+		saveInbox(t, s, 1, 2, 1, 2)
+
+		// chat 2 is refused once, its later update must not be taken in place of the refused one
+		scans := 0
+		claimed, err := s.ClaimInboxUpdates(context.Background(), time.Now(), time.Minute, 10, func() InboxFilter {
+			scans++
+			refused := false
+			return func(chatID int64) bool {
+				if chatID == 2 && !refused {
+					refused = true
+					return false
+				}
+				return true
+			}
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ids := updateIDs(claimed); !reflect.DeepEqual(ids, []int{1, 3}) {
+			t.Errorf("claimed %v, want [1 3]", ids)
+		}
+		if scans == 0 {
+			t.Error("newAccept was never called")
+		}
+	})
+}
+
+func TestClaimInboxUpdatesOrder(t *testing.T) {
+	runContract(t, func(t *testing.T, s Storage) {
+		ctx := context.Background()
+		// numeric order, as strings 10 and 100 would sort before 2 and 9
+		for i, updateID := range []int{10, 9, 100, 2} {
+			err := s.SaveInboxUpdate(ctx, InboxUpdate{UpdateID: updateID, ChatID: int64(i), ReceivedAt: time.Now()})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		claimed, err := s.ClaimInboxUpdates(ctx, time.Now(), time.Minute, 10, acceptAll)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ids := updateIDs(claimed); !reflect.DeepEqual(ids, []int{2, 9, 10, 100}) {
+			t.Errorf("claimed %v, want [2 9 10 100]", ids)
+		}
+	})
+}
+
+func TestSaveInboxUpdateKeepsFirst(t *testing.T) {
+	runContract(t, func(t *testing.T, s Storage) {
+		ctx := context.Background()
+		for _, data := range []string{"first", "redelivered"} {
+			if err := s.SaveInboxUpdate(ctx, InboxUpdate{UpdateID: 1, Data: []byte(data), ReceivedAt: time.Now()}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		claimed, err := s.ClaimInboxUpdates(ctx, time.Now(), time.Minute, 10, acceptAll)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(claimed) != 1 || string(claimed[0].Data) != "first" {
+			t.Errorf("claimed %+v, want the first update only", claimed)
+		}
+	})
+}
+
+func TestInboxLease(t *testing.T) {
+	runContract(t, func(t *testing.T, s Storage) {
+		ctx := context.Background()
+		now := time.Now()
+		saveInbox(t, s, 1)
+
+		first, err := s.ClaimInboxUpdates(ctx, now, time.Minute, 10, acceptAll)
+		if err != nil || len(first) != 1 {
+			t.Fatalf("claim = %+v, %v", first, err)
+		}
+		if again, err := s.ClaimInboxUpdates(ctx, now.Add(30*time.Second), time.Minute, 10, acceptAll); err != nil || len(again) != 0 {
+			t.Fatalf("claim while leased = %+v, %v, want nothing", again, err)
+		}
+		ok, err := s.RenewInboxUpdate(ctx, 1, first[0].ClaimedUntil, now.Add(2*time.Minute))
+		if err != nil || !ok {
+			t.Fatalf("renew by the holder = %v, %v, want true", ok, err)
+		}
+
+		// the worker stalls past its renewed lease and another one claims the update
+		second, err := s.ClaimInboxUpdates(ctx, now.Add(3*time.Minute), time.Minute, 10, acceptAll)
+		if err != nil || len(second) != 1 {
+			t.Fatalf("claim after the lease expired = %+v, %v, want the update again", second, err)
+		}
+		if ok, err = s.RenewInboxUpdate(ctx, 1, now.Add(2*time.Minute), now.Add(5*time.Minute)); err != nil || ok {
+			t.Errorf("renew by the stalled worker = %v, %v, want false", ok, err)
+		}
+		if ok, err = s.RenewInboxUpdate(ctx, 1, second[0].ClaimedUntil, now.Add(5*time.Minute)); err != nil || !ok {
+			t.Errorf("renew by the new holder = %v, %v, want true", ok, err)
+		}
+
+		if err = s.AckInboxUpdate(ctx, 1); err != nil {
+			t.Fatal(err)
+		}
+		if ok, err = s.RenewInboxUpdate(ctx, 1, now.Add(5*time.Minute), now.Add(6*time.Minute)); err != nil || ok {
+			t.Errorf("renew after ack = %v, %v, want false", ok, err)
+		}
+		if claimed, err := s.ClaimInboxUpdates(ctx, now.Add(time.Hour), time.Minute, 10, acceptAll); err != nil || len(claimed) != 0 {
+			t.Errorf("claim after ack = %+v, %v, want nothing", claimed, err)
+		}
+	})
+}
+
+func TestClaimNextPublish(t *testing.T) {
+	runContract(t, func(t *testing.T, s Storage) {
+		ctx := context.Background()
+		slot := time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC)
+		for i, id := range []string{"a", "b"} {
+			err := s.EnqueuePublish(ctx, QueueItem{ID: id, ChatID: 1, MessageID: i + 1, EnqueuedAt: slot.Add(-time.Duration(2-i) * time.Hour)})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		item, ok, err := s.ClaimNextPublish(ctx, slot, slot.Add(time.Minute), 5*time.Minute)
+		if err != nil || !ok || item.ID != "a" || item.Attempts != 1 {
+			t.Fatalf("claim = %+v, %v, %v, want a on its first attempt", item, ok, err)
+		}
+		// the cron fires again in the same slot
+		if item, ok, err = s.ClaimNextPublish(ctx, slot, slot.Add(2*time.Minute), 5*time.Minute); err != nil || ok {
+			t.Fatalf("second claim in the slot = %+v, %v, %v, want nothing", item, ok, err)
+		}
+
+		// a is still leased in the next slot, its publisher may still be at it
+		next := slot.Add(3 * time.Minute)
+		if item, ok, err = s.ClaimNextPublish(ctx, next, next, 5*time.Minute); err != nil || !ok || item.ID != "b" {
+			t.Fatalf("claim in the next slot = %+v, %v, %v, want b", item, ok, err)
+		}
+		// a's publisher died, it comes back once the lease expired
+		later := slot.Add(time.Hour)
+		if item, ok, err = s.ClaimNextPublish(ctx, later, later, 5*time.Minute); err != nil || !ok || item.ID != "a" || item.Attempts != 2 {
+			t.Fatalf("claim after the lease = %+v, %v, %v, want a on its second attempt", item, ok, err)
+		}
+
+		if err = s.DequeuePublish(ctx, "a"); err != nil {
+			t.Fatal(err)
+		}
+		items, err := s.ListPublishQueue(ctx)
+		if err != nil || len(items) != 1 || items[0].ID != "b" {
+			t.Errorf("queue = %+v, %v, want b only", items, err)
+		}
+	})
+}
@@ -0,0 +1,214 @@
+// Package telegramtest provides a fake telegram bot api server for tests.
+//
+// The server records every request the bot makes and answers with plausible
+// results, so scenario tests can run the bot without api.telegram.org.
+package telegramtest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// Request a recorded bot api call
+type Request struct {
+	Method string
+	Params url.Values
+}
+
+// ChatID the chat_id param, 0 if missing or not numeric
+func (r Request) ChatID() int64 {
+	id, _ := strconv.ParseInt(r.Params.Get("chat_id"), 10, 64)
+	return id
+}
+
+// HandlerFunc answers one bot api method
+type HandlerFunc func(params url.Values) tgbotapi.APIResponse
+
+// Server fake telegram bot api server
+type Server struct {
+	*httptest.Server
+	// Bot returned by getMe
+	Bot tgbotapi.User
+
+	mu            sync.Mutex
+	requests      []Request
+	handlers      map[string]HandlerFunc
+	nextMessageID int
+	// commands by scope and language_code
+	commands map[string]json.RawMessage
+}
+
+// NewServer start a fake telegram bot api server, call Close when done
+func NewServer() *Server {
+	s := &Server{
+		Bot:      tgbotapi.User{ID: 1, IsBot: true, FirstName: "test", UserName: "test_bot"},
+		handlers: make(map[string]HandlerFunc),
+		commands: make(map[string]json.RawMessage),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// NewClient return a bot api client whose requests go to this server
+func (s *Server) NewClient(token string) (*tgbotapi.BotAPI, error) {
+	target, _ := url.Parse(s.URL)
+	return tgbotapi.NewBotAPIWithClient(token, &http.Client{
+		Transport: rewriteTransport{target: target},
+	})
+}
+
+// Handle override the answer of method, e.g. to simulate api errors
+func (s *Server) Handle(method string, handler HandlerFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[method] = handler
+}
+
+// Requests all recorded requests in arrival order
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// Sent recorded requests which deliver a message to chatID
+func (s *Server) Sent(chatID int64) (sent []Request) {
+	for _, r := range s.Requests() {
+		if isSendMethod(r.Method) && r.ChatID() == chatID {
+			sent = append(sent, r)
+		}
+	}
+	return
+}
+
+// Reset forget recorded requests
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = nil
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		r.ParseMultipartForm(32 << 20)
+		if r.MultipartForm != nil {
+			for field, files := range r.MultipartForm.File {
+				for _, f := range files {
+					r.Form.Add(field, f.Filename)
+				}
+			}
+		}
+	} else {
+		r.ParseForm()
+	}
+	method := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{Method: method, Params: r.Form})
+	handler, ok := s.handlers[method]
+	s.mu.Unlock()
+
+	var resp tgbotapi.APIResponse
+	if ok {
+		resp = handler(r.Form)
+	} else {
+		resp = s.defaultResponse(method, r.Form)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (s *Server) defaultResponse(method string, params url.Values) tgbotapi.APIResponse {
+	switch {
+	case method == "getMe":
+		return ok(s.Bot)
+	case method == "getWebhookInfo":
+		return ok(tgbotapi.WebhookInfo{})
+	case method == "getUpdates":
+		return ok([]tgbotapi.Update{})
+	case method == "setMyCommands":
+		s.mu.Lock()
+		s.commands[commandsKey(params)] = json.RawMessage(params.Get("commands"))
+		s.mu.Unlock()
+		return ok(true)
+	case method == "deleteMyCommands":
+		s.mu.Lock()
+		delete(s.commands, commandsKey(params))
+		s.mu.Unlock()
+		return ok(true)
+	case method == "getMyCommands":
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if commands, found := s.commands[commandsKey(params)]; found {
+			return tgbotapi.APIResponse{Ok: true, Result: commands}
+		}
+		return ok([]struct{}{})
+	case method == "copyMessage":
+		return ok(map[string]int{"message_id": s.newMessageID()})
+	case isSendMethod(method):
+		chatID, _ := strconv.ParseInt(params.Get("chat_id"), 10, 64)
+		return ok(tgbotapi.Message{
+			MessageID: s.newMessageID(),
+			From:      &s.Bot,
+			Chat:      &tgbotapi.Chat{ID: chatID},
+			Date:      int(time.Now().Unix()),
+			Text:      params.Get("text"),
+			Caption:   params.Get("caption"),
+		})
+	}
+	return ok(true)
+}
+
+func (s *Server) newMessageID() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextMessageID++
+	return s.nextMessageID
+}
+
+// isSendMethod methods which put a message into a chat
+func isSendMethod(method string) bool {
+	return strings.HasPrefix(method, "send") ||
+		method == "forwardMessage" ||
+		method == "copyMessage"
+}
+
+func ok(result interface{}) tgbotapi.APIResponse {
+	data, _ := json.Marshal(result)
+	return tgbotapi.APIResponse{Ok: true, Result: data}
+}
+
+// Error build a failed api response, for use in a HandlerFunc
+func Error(code int, description string, parameters *tgbotapi.ResponseParameters) tgbotapi.APIResponse {
+	return tgbotapi.APIResponse{Ok: false, ErrorCode: code, Description: description, Parameters: parameters}
+}
+
+// rewriteTransport send requests for api.telegram.org to target instead
+type rewriteTransport struct {
+	target *url.URL
+}
+
+func (t rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = t.target.Scheme
+	req.URL.Host = t.target.Host
+	req.Host = t.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// commandsKey scope and language of a *MyCommands request
+func commandsKey(params url.Values) string {
+	scope := params.Get("scope")
+	if len(scope) == 0 {
+		scope = `{"type":"default"}`
+	}
+	return scope + " " + params.Get("language_code")
+}